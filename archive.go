@@ -0,0 +1,625 @@
+package main
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "compress/gzip"
+    "crypto/sha256"
+    "errors"
+    "github.com/klauspost/compress/zstd"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// Archive formats which are detected by magic bytes.
+const (
+    formatZip = "zip"
+    formatTar = "tar"
+    formatGzip = "gzip"
+    formatZstd = "zstd"
+)
+
+// archiveSniffLen is enough to find "ustar" of a tar header.
+const archiveSniffLen = 512
+
+// archiveExtensions select an archive source for a URL. A format is
+// detected by magic bytes regardless of an extension.
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz", ".tar.zst", ".tzst"}
+
+// archiveEntry is an entry of an archive before the top directory and
+// a base path are removed from its name.
+type archiveEntry interface {
+    entryName() string
+    entryIsDir() bool
+    // source returns FileSource of the entry at a sub path.
+    source(path string) FileSource
+}
+
+// archiveAccess reads a template from a zip, tar, tar.gz or tar.zst archive
+// of a local path or a URL. A template under a directory of the archive is
+// given by //<path>.
+type archiveAccess struct {
+    location string
+    subPath string
+    httpClient *http.Client
+    revision string
+    archiveHash string
+    entries []archiveEntry
+    files []*os.File
+    tempPaths []string
+}
+
+// tarFileSource is an entry of a tar archive. Contents are read from
+// an offset of the tar file, so that entries can be read in any order.
+type tarFileSource struct {
+    header *tar.Header
+    name string
+    file *os.File
+    offset int64
+    size int64
+    path string
+}
+
+// archiveDirSource is a directory which has no entry in an archive.
+type archiveDirSource struct {
+    path string
+}
+
+func newArchiveDirSource(path string) *archiveDirSource {
+    return &archiveDirSource{path: path}
+}
+
+func newArchiveAccess(src string, config *sourceConfig) (aa *archiveAccess) {
+    if config == nil {
+        config = new(sourceConfig)
+    }
+
+    aa = new(archiveAccess)
+    aa.location, aa.subPath = splitSubPath(src)
+    aa.httpClient = http.DefaultClient
+    if config.httpClient != nil {
+        aa.httpClient = config.httpClient
+    }
+    return
+}
+
+// isArchiveSource returns true for a URL of an archive like *.tar.gz and
+// a local file which has magic bytes of an archive.
+func isArchiveSource(src string) bool {
+    location, _ := splitSubPath(src)
+    if isHTTPSource(location) {
+        srcURL, err := url.Parse(location)
+        if err != nil {
+            return false
+        }
+        urlPath := strings.ToLower(srcURL.Path)
+        for _, extension := range archiveExtensions {
+            if strings.HasSuffix(urlPath, extension) {
+                return true
+            }
+        }
+        return false
+    }
+
+    file, err := os.Open(location)
+    if err != nil {
+        return false
+    }
+    defer file.Close()
+
+    if info, err := file.Stat(); err != nil || info.IsDir() {
+        return false
+    }
+    format, _ := readArchiveFormat(file)
+    return format != ""
+}
+
+// isHTTPSource returns true when src is a http(s) URL.
+func isHTTPSource(src string) bool {
+    return strings.Index(src, "http://") == 0 || strings.Index(src, "https://") == 0
+}
+
+// archiveFormat returns a format of an archive by magic bytes in header.
+// An empty string is returned for an unknown format.
+func archiveFormat(header []byte) string {
+    switch {
+    case bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")):
+        return formatZip
+    case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+        return formatGzip
+    case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+        return formatZstd
+    case len(header) >= 262 && string(header[257:262]) == "ustar":
+        return formatTar
+    }
+    return ""
+}
+
+func readArchiveFormat(file *os.File) (string, error) {
+    header := make([]byte, archiveSniffLen)
+    n, err := file.ReadAt(header, 0)
+    if err != nil && err != io.EOF {
+        return "", err
+    }
+    return archiveFormat(header[:n]), nil
+}
+
+// SourceAccess
+func (aa *archiveAccess) EachSource(callback FileSourceFunc) error {
+    err := aa.open()
+    if err != nil {
+        return err
+    }
+
+    found := aa.subPath == ""
+    err = eachArchiveSource(aa.entries, aa.subPath, func(fileSource FileSource) error {
+        found = true
+        return callback(fileSource)
+    })
+    if err == nil && !found {
+        err = errors.New("No directory " + aa.subPath + " in " + aa.location)
+    }
+    return err
+}
+
+func (aa *archiveAccess) open() (err error) {
+    if aa.entries != nil {
+        return nil
+    }
+    defer func() {
+        if err != nil {
+            aa.Close()
+        }
+    }()
+
+    file, err := aa.openArchive()
+    if err != nil {
+        return err
+    }
+    aa.archiveHash, err = fileChecksum(file)
+    if err != nil {
+        return err
+    }
+
+    format, err := readArchiveFormat(file)
+    if err != nil {
+        return err
+    }
+    if format == formatGzip || format == formatZstd {
+        file, err = aa.decompress(file, format)
+        if err != nil {
+            return err
+        }
+        if format, err = readArchiveFormat(file); err == nil && format != formatTar {
+            err = errors.New("No tar archive is compressed in " + aa.location)
+        }
+        if err != nil {
+            return err
+        }
+    }
+
+    switch format {
+    case formatZip:
+        return aa.readZip(file)
+    case formatTar:
+        return aa.readTar(file)
+    }
+    return errors.New("Unknown archive format: " + aa.location)
+}
+
+// openArchive opens a local archive or downloads an archive to a temporary
+// file.
+func (aa *archiveAccess) openArchive() (*os.File, error) {
+    if !isHTTPSource(aa.location) {
+        file, err := os.Open(aa.location)
+        if err != nil {
+            return nil, err
+        }
+        aa.files = append(aa.files, file)
+        return file, nil
+    }
+
+    httpResponse, err := aa.httpClient.Get(aa.location)
+    if err != nil {
+        return nil, err
+    }
+    defer httpResponse.Body.Close()
+    if httpResponse.StatusCode != http.StatusOK {
+        return nil, errors.New("Failed to download " + aa.location + ": " + httpResponse.Status)
+    }
+
+    file, err := aa.tempFile()
+    if err != nil {
+        return nil, err
+    }
+    _, err = io.Copy(file, httpResponse.Body)
+    return file, err
+}
+
+// decompress writes a decompressed archive to a temporary file.
+func (aa *archiveAccess) decompress(file *os.File, format string) (*os.File, error) {
+    reader, err := newSectionReader(file)
+    if err != nil {
+        return nil, err
+    }
+
+    var decompressed io.Reader
+    if format == formatGzip {
+        gzipReader, err := gzip.NewReader(reader)
+        if err != nil {
+            return nil, err
+        }
+        defer gzipReader.Close()
+        decompressed = gzipReader
+    } else {
+        zstdReader, err := zstd.NewReader(reader)
+        if err != nil {
+            return nil, err
+        }
+        defer zstdReader.Close()
+        decompressed = zstdReader
+    }
+
+    tarFile, err := aa.tempFile()
+    if err != nil {
+        return nil, err
+    }
+    _, err = io.Copy(tarFile, decompressed)
+    return tarFile, err
+}
+
+func (aa *archiveAccess) readZip(file *os.File) error {
+    info, err := file.Stat()
+    if err != nil {
+        return err
+    }
+    zipReader, err := zip.NewReader(file, info.Size())
+    if err != nil {
+        return err
+    }
+
+    // git archive sets a commit to the comment.
+    aa.revision = strings.TrimSpace(zipReader.Comment)
+    aa.entries = make([]archiveEntry, 0, len(zipReader.File))
+    for _, f := range zipReader.File {
+        aa.entries = append(aa.entries, newZipFileSource(f, f.Name))
+    }
+    return nil
+}
+
+// readTar records an offset and a size of each entry. Other types than
+// files, directories and links are ignored.
+func (aa *archiveAccess) readTar(file *os.File) error {
+    _, err := file.Seek(0, io.SeekStart)
+    if err != nil {
+        return err
+    }
+
+    entries := map[string]*tarFileSource{}
+    aa.entries = []archiveEntry{}
+    tarReader := tar.NewReader(file)
+    for {
+        header, err := tarReader.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+
+        switch header.Typeflag {
+        case tar.TypeXGlobalHeader:
+            // git archive sets a commit to the comment.
+            aa.revision = strings.TrimSpace(header.PAXRecords["comment"])
+            continue
+        case tar.TypeReg, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+        default:
+            continue
+        }
+
+        name := strings.TrimPrefix(header.Name, "./")
+        if name == "" || name == "." {
+            continue
+        }
+
+        // Contents start at the current offset because a tar reader reads
+        // nothing ahead.
+        offset, err := file.Seek(0, io.SeekCurrent)
+        if err != nil {
+            return err
+        }
+        tf := &tarFileSource{header: header, name: name, file: file, offset: offset, size: header.Size}
+
+        if header.Typeflag == tar.TypeLink {
+            // A hard link has contents of an earlier entry.
+            target, ok := entries[strings.TrimPrefix(header.Linkname, "./")]
+            if !ok {
+                return errors.New("No target of a hard link " + header.Name + " in " + aa.location)
+            }
+            tf.offset = target.offset
+            tf.size = target.size
+        }
+        entries[name] = tf
+        aa.entries = append(aa.entries, tf)
+    }
+}
+
+// tempFile returns a temporary file which is removed by Close.
+func (aa *archiveAccess) tempFile() (*os.File, error) {
+    file, err := ioutil.TempFile("", "gokeleton-archive")
+    if err != nil {
+        return nil, err
+    }
+    aa.files = append(aa.files, file)
+    aa.tempPaths = append(aa.tempPaths, file.Name())
+    return file, nil
+}
+
+// Close closes an archive and removes temporary files.
+func (aa *archiveAccess) Close() (err error) {
+    for _, file := range aa.files {
+        file.Close()
+    }
+    for _, tempPath := range aa.tempPaths {
+        if removeErr := os.Remove(tempPath); removeErr != nil && err == nil {
+            err = removeErr
+        }
+    }
+    aa.files = nil
+    aa.tempPaths = nil
+    aa.entries = nil
+    return
+}
+
+// SourceRevision
+func (aa *archiveAccess) Revision() string {
+    return aa.revision
+}
+
+func (aa *archiveAccess) ArchiveHash() string {
+    return aa.archiveHash
+}
+
+// FileSource
+func (tf *tarFileSource) SubPath() string {
+    return tf.path
+}
+
+func (tf *tarFileSource) IsDir() bool {
+    return tf.header.Typeflag == tar.TypeDir
+}
+
+func (tf *tarFileSource) Reader() (io.ReadCloser, error) {
+    return ioutil.NopCloser(io.NewSectionReader(tf.file, tf.offset, tf.size)), nil
+}
+
+func (tf *tarFileSource) Mode() os.FileMode {
+    return tf.header.FileInfo().Mode()
+}
+
+func (tf *tarFileSource) LinkTarget() (string, error) {
+    return tf.header.Linkname, nil
+}
+
+// archiveEntry
+func (tf *tarFileSource) entryName() string {
+    return tf.name
+}
+
+func (tf *tarFileSource) entryIsDir() bool {
+    return tf.IsDir()
+}
+
+func (tf *tarFileSource) source(path string) FileSource {
+    source := *tf
+    source.path = path
+    return &source
+}
+
+// FileSource
+func (ad *archiveDirSource) SubPath() string {
+    return ad.path
+}
+
+func (ad *archiveDirSource) IsDir() bool {
+    return true
+}
+
+func (ad *archiveDirSource) Reader() (io.ReadCloser, error) {
+    return nil, errors.New("Directory can't be read: " + ad.path)
+}
+
+func (ad *archiveDirSource) Mode() os.FileMode {
+    return os.ModeDir | 0755
+}
+
+func (ad *archiveDirSource) LinkTarget() (string, error) {
+    return "", nil
+}
+
+// eachArchiveSource calls callback for entries under basePath of an
+// archive. The top directory like <repo>-<commit>/ is removed from names
+// when all entries are in it.
+func eachArchiveSource(entries []archiveEntry, basePath string, callback FileSourceFunc) (err error) {
+    // Names are checked before any entry is walked, so that nothing is
+    // generated from an archive which has a path out of a dest path.
+    entryNames := make([]string, len(entries))
+    for i, entry := range entries {
+        entryNames[i], err = cleanArchiveName(entry.entryName(), entry.entryIsDir())
+        if err != nil {
+            return err
+        }
+    }
+    topDir := archiveTopDir(entryNames)
+
+    rules := new(ignoreRules)
+    for i, entry := range entries {
+        if name, ok := archiveEntryName(entryNames[i], topDir, basePath); ok && name == ignoreFileName {
+            rules = readIgnore(entry.source(name))
+        }
+    }
+
+    // Entries under these directories are skipped by filepath.SkipDir.
+    var skipDirs []string
+    // Directories which are walked already. A directory which has no entry
+    // is walked before its files because some archives have only files.
+    walkedDirs := map[string]bool{}
+
+    walk := func(name string, isDir bool, fileSource FileSource) error {
+        dir := strings.TrimSuffix(name, "/")
+        if isUnderDirs(skipDirs, name) || (isDir && walkedDirs[dir]) {
+            return nil
+        }
+        if isDir {
+            walkedDirs[dir] = true
+        }
+
+        if rules.isIgnored(name, isDir) {
+            if isDir {
+                skipDirs = append(skipDirs, archiveSkipDir(dir))
+            }
+            return nil
+        }
+
+        // Check file should be called or not
+        err := callback(fileSource)
+        if err == filepath.SkipDir {
+            if isDir {
+                skipDirs = append(skipDirs, archiveSkipDir(dir))
+            }
+            return nil
+        }
+        return err
+    }
+
+    for i, entry := range entries {
+        if entryNames[i] == "" {
+            continue
+        }
+        name, ok := archiveEntryName(entryNames[i], topDir, basePath)
+        if !ok {
+            continue
+        }
+
+        for _, dir := range archiveParentDirs(name) {
+            if err = walk(dir, true, newArchiveDirSource(dir)); err != nil {
+                return err
+            }
+        }
+        if err = walk(name, entry.entryIsDir(), entry.source(name)); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// archiveParentDirs returns parent directories of name from the root.
+func archiveParentDirs(name string) []string {
+    if name == "" {
+        return nil
+    }
+
+    dirs := []string{""}
+    elements := strings.Split(strings.TrimSuffix(name, "/"), "/")
+    for i := 1; i < len(elements); i++ {
+        dirs = append(dirs, strings.Join(elements[:i], "/"))
+    }
+    return dirs
+}
+
+// archiveSkipDir returns a prefix of names under dir. Everything is under
+// the root.
+func archiveSkipDir(dir string) string {
+    if dir == "" {
+        return ""
+    }
+    return dir + "/"
+}
+
+// archiveTopDir returns a top directory with a slash which has all entries.
+// An empty string is returned when some entries are at the top level.
+func archiveTopDir(entryNames []string) string {
+    topDir := ""
+    for _, name := range entryNames {
+        if name == "" {
+            continue
+        }
+        index := strings.Index(name, "/")
+        if index == -1 {
+            return ""
+        }
+        if topDir == "" {
+            topDir = name[:index + 1]
+        } else if topDir != name[:index + 1] {
+            return ""
+        }
+    }
+    return topDir
+}
+
+// cleanArchiveName returns a cleaned name of an archive entry. A directory
+// has a trailing slash. An absolute name and a name out of the archive like
+// ../x are errors. The archive itself like ./ is an empty name.
+func cleanArchiveName(entryName string, isDir bool) (string, error) {
+    name := path.Clean(entryName)
+    if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+        return "", errors.New("Unsafe path in an archive: " + entryName)
+    }
+    if name == "." {
+        return "", nil
+    }
+    if isDir {
+        name += "/"
+    }
+    return name, nil
+}
+
+// archiveEntryName returns a sub path of an archive entry without the top
+// directory and the base path. ok is false when the entry is not under
+// the base path.
+func archiveEntryName(entryName string, topDir string, basePath string) (name string, ok bool) {
+    name = strings.TrimPrefix(entryName, topDir)
+
+    // The base path is matched by whole elements, so that book doesn't
+    // match bookshelf/.
+    if basePath = strings.Trim(basePath, "/"); basePath != "" {
+        if !strings.HasPrefix(name, basePath + "/") {
+            return "", false
+        }
+        name = name[len(basePath) + 1:]
+    }
+    return name, true
+}
+
+// newSectionReader returns a reader of a whole file which doesn't depend on
+// the offset of the file.
+func newSectionReader(file *os.File) (*io.SectionReader, error) {
+    info, err := file.Stat()
+    if err != nil {
+        return nil, err
+    }
+    return io.NewSectionReader(file, 0, info.Size()), nil
+}
+
+// fileChecksum returns a checksum of a whole file.
+func fileChecksum(file *os.File) (string, error) {
+    reader, err := newSectionReader(file)
+    if err != nil {
+        return "", err
+    }
+
+    hash := sha256.New()
+    _, err = io.Copy(hash, reader)
+    if err != nil {
+        return "", err
+    }
+    return checksumString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "compress/gzip"
+    "github.com/klauspost/compress/zstd"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "testing"
+)
+
+// newTestTar returns a tar whose entries are given as name, contents pairs.
+// A name with a trailing slash is a directory and contents starting with
+// "->" or "=>" are a symbolic link or a hard link.
+func newTestTar(t *testing.T, comment string, entries ...string) []byte {
+    buf := new(bytes.Buffer)
+    w := tar.NewWriter(buf)
+    if comment != "" {
+        w.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": comment}})
+    }
+    for i := 0; i < len(entries); i += 2 {
+        name, contents := entries[i], entries[i + 1]
+        header := &tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(contents))}
+        switch {
+        case strings.HasSuffix(name, "/"):
+            header.Typeflag, header.Mode = tar.TypeDir, 0755
+        case strings.HasPrefix(contents, "->"):
+            header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, contents[2:], 0
+        case strings.HasPrefix(contents, "=>"):
+            header.Typeflag, header.Linkname, header.Size = tar.TypeLink, contents[2:], 0
+        }
+        if err := w.WriteHeader(header); err != nil {
+            t.Fatal(err)
+        }
+        if header.Typeflag == tar.TypeReg {
+            w.Write([]byte(contents))
+        }
+    }
+    w.Close()
+    return buf.Bytes()
+}
+
+// writeTestArchive writes an archive into a new temporary directory.
+// A caller removes the directory of the returned path.
+func writeTestArchive(t *testing.T, name string, contents []byte) string {
+    dir, err := ioutil.TempDir("", "gokeleton-archive-test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    archivePath := filepath.Join(dir, name)
+    ioutil.WriteFile(archivePath, contents, 0644)
+    return archivePath
+}
+
+func readTestSources(t *testing.T, sa SourceAccess) map[string]string {
+    found := map[string]string{}
+    err := sa.EachSource(func(fileSource FileSource) error {
+        if fileSource.IsDir() {
+            found[fileSource.SubPath()] = "dir"
+        } else if fileSource.Mode() & os.ModeSymlink != 0 {
+            target, _ := fileSource.LinkTarget()
+            found[fileSource.SubPath()] = "->" + target
+        } else {
+            reader, _ := fileSource.Reader()
+            contents, _ := ioutil.ReadAll(reader)
+            reader.Close()
+            found[fileSource.SubPath()] = string(contents)
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return found
+}
+
+// collectSubPaths returns sorted sub paths found by readTestSources.
+func collectSubPaths(t *testing.T, sa SourceAccess) string {
+    var subPaths []string
+    for subPath := range readTestSources(t, sa) {
+        subPaths = append(subPaths, subPath)
+    }
+    sort.Strings(subPaths)
+    return strings.Join(subPaths, ",")
+}
+
+func Test_archiveFormat(t *testing.T) {
+    assertString(t, "Verify zip", formatZip, archiveFormat(newTestZipBytes("a.txt")))
+    assertString(t, "Verify tar", formatTar, archiveFormat(newTestTar(t, "", "a.txt", "a")))
+    assertString(t, "Verify gzip", formatGzip, archiveFormat([]byte{0x1f, 0x8b, 8}))
+    assertString(t, "Verify zstd", formatZstd, archiveFormat([]byte{0x28, 0xb5, 0x2f, 0xfd}))
+    assertString(t, "Verify an unknown format", "", archiveFormat([]byte("hello")))
+}
+
+func Test_archiveAccess_tarGz(t *testing.T) {
+    longName := "app-1.0/sub/" + strings.Repeat("x", 120) + ".txt"
+    tarBytes := newTestTar(t, "0123456",
+        "app-1.0/", "",
+        "app-1.0/README.md", "readme",
+        "app-1.0/sub/", "",
+        "app-1.0/sub/a.txt", "a",
+        longName, "long",
+        "app-1.0/sub/link", "->a.txt",
+        "app-1.0/sub/hard.txt", "=>app-1.0/sub/a.txt")
+    buf := new(bytes.Buffer)
+    gzipWriter := gzip.NewWriter(buf)
+    gzipWriter.Write(tarBytes)
+    gzipWriter.Close()
+
+    // An extension doesn't decide a format.
+    archivePath := writeTestArchive(t, "template.bin", buf.Bytes())
+    defer os.RemoveAll(filepath.Dir(archivePath))
+
+    aa := newArchiveAccess(archivePath + "//sub", nil)
+    found := readTestSources(t, aa)
+    assertString(t, "Verify a file under a sub path", "a", found["a.txt"])
+    assertString(t, "Verify a long name", "long", found[strings.TrimPrefix(longName, "app-1.0/sub/")])
+    assertString(t, "Verify a symbolic link", "->a.txt", found["link"])
+    assertString(t, "Verify a hard link", "a", found["hard.txt"])
+    if _, ok := found["README.md"]; ok || len(found) != 5 {
+        t.Error("Verify only entries under a sub path are walked.", found)
+    }
+    assertString(t, "Verify a commit of git archive", "0123456", aa.Revision())
+    assertString(t, "Verify a hash of the archive", checksum(buf.Bytes()), aa.ArchiveHash())
+
+    tempPaths := aa.tempPaths
+    if err := aa.Close(); err != nil || len(tempPaths) != 1 {
+        t.Error("Verify a decompressed tar is removed.", tempPaths, err)
+    }
+    if _, err := os.Stat(archivePath); err != nil {
+        t.Error("Verify a local archive is not removed.", err)
+    }
+}
+
+func Test_archiveAccess_tarZst(t *testing.T) {
+    buf := new(bytes.Buffer)
+    zstdWriter, _ := zstd.NewWriter(buf)
+    zstdWriter.Write(newTestTar(t, "", "./README.md", "readme", "./docs/a.md", "a"))
+    zstdWriter.Close()
+
+    archivePath := writeTestArchive(t, "template.tar.zst", buf.Bytes())
+    defer os.RemoveAll(filepath.Dir(archivePath))
+
+    aa := newArchiveAccess(archivePath, nil)
+    defer aa.Close()
+    found := readTestSources(t, aa)
+    assertString(t, "Verify a top level file is kept", "readme", found["README.md"])
+    assertString(t, "Verify a directory without a top directory is kept", "a", found["docs/a.md"])
+    assertString(t, "Verify a missing root directory is walked", "dir", found[""])
+    assertString(t, "Verify a missing directory is walked", "dir", found["docs"])
+
+    aa = newArchiveAccess(archivePath + "//nothing", nil)
+    defer aa.Close()
+    if err := aa.EachSource(func(fileSource FileSource) error { return nil }); err == nil {
+        t.Error("Verify a missing sub path is an error.")
+    }
+}
+
+func Test_archiveAccess_siblingSubPath(t *testing.T) {
+    archivePath := writeTestArchive(t, "template.tar", newTestTar(t, "",
+        "proj/book/a.txt", "a",
+        "proj/bookshelf/secret.txt", "secret"))
+    defer os.RemoveAll(filepath.Dir(archivePath))
+
+    aa := newArchiveAccess(archivePath + "//book", nil)
+    defer aa.Close()
+    found := readTestSources(t, aa)
+    if len(found) != 2 || found["a.txt"] != "a" {
+        t.Error("Verify a sibling directory with the same prefix is not walked.", found)
+    }
+
+    aa = newArchiveAccess(archivePath + "//boo", nil)
+    defer aa.Close()
+    if err := aa.EachSource(func(fileSource FileSource) error { return nil }); err == nil {
+        t.Error("Verify a prefix of a directory is not a sub path.")
+    }
+}
+
+func Test_archiveAccess_zipURL(t *testing.T) {
+    zipBytes := newTestZipArchive("0123456", []string{"app/", "app/README.md"}, map[string]string{"app/README.md": "readme"})
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/releases/template.zip" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Write(zipBytes)
+    }))
+    defer server.Close()
+
+    config := &sourceConfig{httpClient: server.Client()}
+    sa, ok := newSourceAccess(server.URL + "/releases/template.zip", config).(*archiveAccess)
+    if !ok {
+        t.Fatal("Verify an archive URL is read by archiveAccess.")
+    }
+    defer sa.Close()
+    assertString(t, "Verify a file in an archive of a URL", "readme", readTestSources(t, sa)["README.md"])
+    assertString(t, "Verify a commit in a comment", "0123456", sa.Revision())
+
+    aa := newArchiveAccess(server.URL + "/releases/unknown.zip", config)
+    if err := aa.EachSource(func(fileSource FileSource) error { return nil }); err == nil || !strings.Contains(err.Error(), "404") {
+        t.Error("Verify a failed download is an error.", err)
+    }
+}
+
+func Test_archiveAccess_unknownFormat(t *testing.T) {
+    buf := new(bytes.Buffer)
+    gzipWriter := gzip.NewWriter(buf)
+    io.WriteString(gzipWriter, "not a tar")
+    gzipWriter.Close()
+
+    archivePath := writeTestArchive(t, "template.tar.gz", buf.Bytes())
+    defer os.RemoveAll(filepath.Dir(archivePath))
+
+    aa := newArchiveAccess(archivePath, nil)
+    if err := aa.EachSource(func(fileSource FileSource) error { return nil }); err == nil {
+        t.Error("Verify gzip without a tar is an error.")
+    }
+    if len(aa.tempPaths) != 0 {
+        t.Error("Verify temporary files are removed on an error.", aa.tempPaths)
+    }
+}
+
+func Test_isArchiveSource(t *testing.T) {
+    archivePath := writeTestArchive(t, "template", newTestZipBytes("a.txt"))
+    defer os.RemoveAll(filepath.Dir(archivePath))
+    textPath := filepath.Join(filepath.Dir(archivePath), "a.txt")
+    ioutil.WriteFile(textPath, []byte("a"), 0644)
+
+    for _, src := range []string{archivePath, archivePath + "//sub", "https://example.com/t.tar.gz", "https://example.com/t.TGZ//sub"} {
+        if !isArchiveSource(src) {
+            t.Error("Verify an archive source.", src)
+        }
+    }
+    for _, src := range []string{textPath, filepath.Dir(archivePath), "https://example.com/org/repo"} {
+        if isArchiveSource(src) {
+            t.Error("Verify not an archive source.", src)
+        }
+    }
+}
+
+func Test_archiveAccess_unsafePath(t *testing.T) {
+    for _, name := range []string{"../evil.txt", "a/../../evil.txt", "/tmp/evil.txt"} {
+        archivePath := writeTestArchive(t, "template.tar", newTestTar(t, "", "a/x.txt", "x", name, "evil"))
+        defer os.RemoveAll(filepath.Dir(archivePath))
+
+        aa := newArchiveAccess(archivePath, nil)
+        var walked []string
+        err := aa.EachSource(func(fileSource FileSource) error {
+            walked = append(walked, fileSource.SubPath())
+            return nil
+        })
+        aa.Close()
+        if err == nil || len(walked) != 0 {
+            t.Error("Verify a tar with an unsafe path is an error before walking.", name, walked, err)
+        }
+    }
+
+    zipBytes := newTestZipBytes("a/x.txt", "a/../../evil.txt")
+    zipReader, _ := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+    var walked []string
+    err := eachZipSource(zipReader, "", func(fileSource FileSource) error {
+        walked = append(walked, fileSource.SubPath())
+        return nil
+    })
+    if err == nil || len(walked) != 0 {
+        t.Error("Verify a zip with an unsafe path is an error before walking.", walked, err)
+    }
+}
+
+func Test_StartMain_archiveSymlinkOut(t *testing.T) {
+    outsideDir, _ := ioutil.TempDir("", "gokeleton-outside")
+    defer os.RemoveAll(outsideDir)
+    archivePath := writeTestArchive(t, "template.tar", newTestTar(t, "", "t/s", "->" + outsideDir, "t/s/pwn.txt", "pwn"))
+    defer os.RemoveAll(filepath.Dir(archivePath))
+    destDir := filepath.Join(filepath.Dir(archivePath), "project")
+
+    err := StartMain(StartParams{
+        KeySeparator: ",",
+        Arguments: []string{archivePath, destDir},
+        IncludeSuffixes: "*"})
+    if err == nil {
+        t.Error("Verify a symbolic link out of a dest path is an error.")
+    }
+    if files, _ := ioutil.ReadDir(outsideDir); len(files) != 0 {
+        t.Error("Verify nothing is written out of a dest path.", files)
+    }
+}
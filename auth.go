@@ -0,0 +1,126 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "os/exec"
+    "strings"
+)
+
+// Environment variables of tokens for hosting services.
+const (
+    tokenEnvName = "GITHUB_TOKEN"
+    gitlabTokenEnvName = "GITLAB_TOKEN"
+    bitbucketTokenEnvName = "BITBUCKET_TOKEN"
+)
+
+// tokenTransport sets a token to requests only for a host, so that the token
+// isn't sent to other hosts like a redirected download URL. The token is
+// set to a header with a prefix like "token " because hosting services
+// expect different headers. A token is sent as a password of Basic auth
+// when username is set.
+type tokenTransport struct {
+    token string
+    username string
+    host string
+    header string
+    prefix string
+    base http.RoundTripper
+}
+
+func (tt *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    base := tt.base
+    if base == nil {
+        base = http.DefaultTransport
+    }
+    if tt.token == "" || req.URL.Host != tt.host {
+        return base.RoundTrip(req)
+    }
+
+    // A RoundTripper must not modify a given request.
+    authReq := new(http.Request)
+    *authReq = *req
+    authReq.Header = make(http.Header, len(req.Header) + 1)
+    for key, values := range req.Header {
+        authReq.Header[key] = values
+    }
+    if tt.username != "" {
+        authReq.SetBasicAuth(tt.username, tt.token)
+    } else {
+        authReq.Header.Set(tt.header, tt.prefix + tt.token)
+    }
+    return base.RoundTrip(authReq)
+}
+
+// newTokenClient returns a client which sends a token set to the returned
+// transport. http.DefaultClient is wrapped when httpClient is nil.
+func newTokenClient(httpClient *http.Client, header string, prefix string) (*http.Client, *tokenTransport) {
+    if httpClient == nil {
+        httpClient = http.DefaultClient
+    }
+
+    auth := &tokenTransport{header: header, prefix: prefix, base: httpClient.Transport}
+    return &http.Client{
+        Transport: auth,
+        CheckRedirect: httpClient.CheckRedirect,
+        Jar: httpClient.Jar,
+        Timeout: httpClient.Timeout}, auth
+}
+
+// findToken returns a token from a token file, an environment variable
+// like GITHUB_TOKEN or a git credential helper for a host in this order.
+// An empty token means anonymous access. username is set only for
+// a password of a git credential helper.
+func findToken(tokenFile string, envName string, host string) (token string, username string, err error) {
+    if tokenFile != "" {
+        contents, err := ioutil.ReadFile(tokenFile)
+        if err != nil {
+            return "", "", err
+        }
+        token = strings.TrimSpace(string(contents))
+        if token == "" {
+            return "", "", errors.New("Token file is empty: " + tokenFile)
+        }
+        return token, "", nil
+    }
+
+    if token = strings.TrimSpace(os.Getenv(envName)); token != "" {
+        return token, "", nil
+    }
+
+    username, token = gitCredential(host)
+    return token, username, nil
+}
+
+// gitCredential returns a username and a password stored by a git
+// credential helper. They are empty when git or a credential is not found.
+func gitCredential(host string) (username string, password string) {
+    cmd := exec.Command("git", "credential", "fill")
+    cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+    // Never ask a user for a credential. GCM_INTERACTIVE keeps Git
+    // Credential Manager from opening a dialog for anonymous access.
+    cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=true", "GCM_INTERACTIVE=never")
+    out, err := cmd.Output()
+    if err != nil {
+        return "", ""
+    }
+
+    scanner := bufio.NewScanner(bytes.NewReader(out))
+    for scanner.Scan() {
+        line := scanner.Text()
+        switch {
+        case strings.HasPrefix(line, "username="):
+            username = strings.TrimPrefix(line, "username=")
+        case strings.HasPrefix(line, "password="):
+            password = strings.TrimPrefix(line, "password=")
+        }
+    }
+    if password == "" {
+        return "", ""
+    }
+    return username, password
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func setTestEnv(t *testing.T, name string, value string) func() {
+    old, ok := os.LookupEnv(name)
+    os.Setenv(name, value)
+    return func() {
+        if ok {
+            os.Setenv(name, old)
+        } else {
+            os.Unsetenv(name)
+        }
+    }
+}
+
+func Test_tokenTransport(t *testing.T) {
+    var headers []string
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        headers = append(headers, r.Header.Get("Authorization"))
+    }))
+    defer server.Close()
+
+    host := strings.TrimPrefix(server.URL, "http://")
+    client := &http.Client{Transport: &tokenTransport{token: "secret", host: host, header: "Authorization", prefix: "token "}}
+    client.Get(server.URL)
+    client = &http.Client{Transport: &tokenTransport{token: "secret", host: "api.github.com", header: "Authorization", prefix: "token "}}
+    client.Get(server.URL)
+    client = &http.Client{Transport: &tokenTransport{token: "secret", username: "user", host: host, header: "Authorization", prefix: "token "}}
+    client.Get(server.URL)
+
+    assertString(t, "Verify a token is sent only to the host, and by Basic auth with a username",
+        "token secret,,Basic dXNlcjpzZWNyZXQ=", strings.Join(headers, ","))
+}
+
+func Test_findToken(t *testing.T) {
+    defer setTestEnv(t, tokenEnvName, "env-token")()
+
+    tokenFile := filepath.Join(os.TempDir(), "gokeleton-token-test")
+    ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600)
+    defer os.Remove(tokenFile)
+
+    token, _, _ := findToken(tokenFile, tokenEnvName, "github.com")
+    assertString(t, "Verify a token file takes precedence", "file-token", token)
+    token, _, _ = findToken("", tokenEnvName, "github.com")
+    assertString(t, "Verify GITHUB_TOKEN is used", "env-token", token)
+
+    ioutil.WriteFile(tokenFile, []byte("\n"), 0600)
+    if _, _, err := findToken(tokenFile, tokenEnvName, "github.com"); err == nil {
+        t.Error("Verify an empty token file is an error.")
+    }
+}
+
+func Test_gitCredential(t *testing.T) {
+    homeDir, _ := ioutil.TempDir("", "gokeleton-home")
+    defer os.RemoveAll(homeDir)
+    ioutil.WriteFile(filepath.Join(homeDir, ".gitconfig"), []byte("[credential]\n\thelper = \"!f() { echo username=x; echo password=helper-token; }; f\"\n"), 0600)
+    defer setTestEnv(t, "HOME", homeDir)()
+    defer setTestEnv(t, "GIT_CONFIG_NOSYSTEM", "1")()
+
+    username, password := gitCredential("github.com")
+    assertString(t, "Verify a username from a credential helper", "x", username)
+    assertString(t, "Verify a token from a credential helper", "helper-token", password)
+
+    ioutil.WriteFile(filepath.Join(homeDir, ".gitconfig"), []byte("[credential]\n\thelper = \"!f() { echo username=x; echo password=$GCM_INTERACTIVE; }; f\"\n"), 0600)
+    _, password = gitCredential("github.com")
+    assertString(t, "Verify a credential helper is not interactive", "never", password)
+}
+
+func Test_getZipArchive_token(t *testing.T) {
+    defer setTestEnv(t, tokenEnvName, "secret")()
+
+    zipBytes := newTestZipBytes("hata-gorep-0123456/", "hata-gorep-0123456/README.md")
+    mux := http.NewServeMux()
+    server := httptest.NewServer(mux)
+    defer server.Close()
+    mux.HandleFunc("/api/v3/repos/hata/gorep/zipball", func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "token secret" {
+            http.NotFound(w, r)
+            return
+        }
+        http.Redirect(w, r, server.URL + "/archive.zip", http.StatusFound)
+    })
+    mux.HandleFunc("/archive.zip", func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "token secret" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Write(zipBytes)
+    })
+
+    ga := newGithubAccess(server.URL + "/hata/gorep", &sourceConfig{githubAPIURL: server.URL + "/api/v3", httpClient: server.Client()})
+    defer ga.Close()
+    if _, err := ga.getZipArchive(); err != nil {
+        t.Error("Verify a token is used for an API and a download.", err)
+    }
+}
+
+func Test_getZipArchive_errors(t *testing.T) {
+    defer setTestEnv(t, tokenEnvName, "")()
+    defer setTestEnv(t, "GIT_CONFIG_NOSYSTEM", "1")()
+    defer setTestEnv(t, "HOME", os.TempDir())()
+
+    status := http.StatusNotFound
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if status == http.StatusForbidden {
+            w.Header().Set("X-RateLimit-Remaining", "0")
+            w.Header().Set("X-RateLimit-Reset", "1700000000")
+        }
+        w.WriteHeader(status)
+    }))
+    defer server.Close()
+
+    ga := newGithubAccess(sampleURL, &sourceConfig{githubAPIURL: server.URL, httpClient: server.Client()})
+    _, err := ga.getZipArchive()
+    if err == nil || !strings.Contains(err.Error(), "not found") || !strings.Contains(err.Error(), tokenEnvName) {
+        t.Error("Verify not found suggests a token.", err)
+    }
+
+    status = http.StatusForbidden
+    ga = newGithubAccess(sampleURL, &sourceConfig{githubAPIURL: server.URL, httpClient: server.Client()})
+    _, err = ga.getZipArchive()
+    if err == nil || !strings.Contains(err.Error(), "rate limit") {
+        t.Error("Verify a rate limit is explained.", err)
+    }
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+    "bytes"
+    "net/http"
+    "strings"
+    "unicode/utf8"
+)
+
+// binarySniffLen is the number of bytes to check whether a file is binary.
+const binarySniffLen = 512
+
+// isBinary returns true when the beginning of a file looks like binary.
+// A file which has NUL bytes, invalid UTF-8 or non text content type is binary.
+func isBinary(contents []byte) bool {
+    sample := contents
+    if len(sample) > binarySniffLen {
+        sample = sample[:binarySniffLen]
+    }
+    if len(sample) == 0 {
+        return false
+    }
+
+    if bytes.IndexByte(sample, 0) >= 0 {
+        return true
+    }
+
+    for i := 0; i < len(sample); {
+        r, size := utf8.DecodeRune(sample[i:])
+        if r == utf8.RuneError && size == 1 {
+            // A rune may be cut at the end of the sample.
+            if len(sample) == binarySniffLen && len(sample) - i < utf8.UTFMax && !utf8.FullRune(sample[i:]) {
+                break
+            }
+            return true
+        }
+        i += size
+    }
+
+    return !isTextContentType(http.DetectContentType(sample))
+}
+
+func isTextContentType(contentType string) bool {
+    if strings.HasPrefix(contentType, "text/") {
+        return true
+    }
+    for _, textType := range []string{"application/json", "application/javascript", "application/xml", "image/svg+xml"} {
+        if strings.HasPrefix(contentType, textType) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "bytes"
+    "os"
+    "strings"
+    "testing"
+)
+
+func Test_isBinary_text(t *testing.T) {
+    for _, text := range []string{"", "package main\n", "<html><body>foo</body></html>", "{\"foo\": 1}", "日本語のテキスト"} {
+        if isBinary([]byte(text)) {
+            t.Error("Verify text is not binary: " + text)
+        }
+    }
+}
+
+func Test_isBinary_cutRune(t *testing.T) {
+    contents := []byte(strings.Repeat("a", binarySniffLen - 1) + "日本")
+    if isBinary(contents) {
+        t.Error("Verify a rune cut at the end of a sample is not binary")
+    }
+}
+
+func Test_isBinary_binary(t *testing.T) {
+    samples := [][]byte{
+        []byte("abc\x00def"),
+        []byte("\x89PNG\r\n\x1a\n"),
+        []byte("PK\x03\x04"),
+        []byte("%PDF-1.4\n"),
+        []byte("wOF2abcd"),
+        []byte{0xff, 0xfe, 0xfd, 'a'},
+    }
+    for _, sample := range samples {
+        if !isBinary(sample) {
+            t.Errorf("Verify binary is detected: %q", sample)
+        }
+    }
+}
+
+func Test_copyEachFileSource_binary(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{"foo.ico": "\x00\x00\x01\x00foo", "foo.txt": "foo"})
+    defer os.RemoveAll(srcDir)
+
+    da := newMemoryDestAccess()
+    copyEachFileSource(newFileAccess(srcDir), da, newTestFilter(t, "*", ""), newReplaceFunc(map[string]string{"foo": "bar"}), nil)
+    for _, file := range da.files {
+        if file.subPath == "bar.ico" && !bytes.Equal(file.contents, []byte("\x00\x00\x01\x00foo")) {
+            t.Error("Verify a binary file is copied byte for byte")
+        }
+        if file.subPath == "bar.txt" && string(file.contents) != "bar" {
+            t.Error("Verify a text file is replaced")
+        }
+    }
+
+    filter := newTestFilter(t, "*", "")
+    filter.noBinaryDetect = true
+    da = newMemoryDestAccess()
+    copyEachFileSource(newFileAccess(srcDir), da, filter, newReplaceFunc(map[string]string{"foo": "bar"}), nil)
+    for _, file := range da.files {
+        if file.subPath == "bar.ico" && !bytes.Equal(file.contents, []byte("\x00\x00\x01\x00bar")) {
+            t.Error("Verify binary detection can be disabled")
+        }
+    }
+}
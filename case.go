@@ -0,0 +1,118 @@
+package main
+
+import (
+    "sort"
+    "strings"
+    "unicode"
+)
+
+// caseVariants derive identifiers from words of a keyword.
+var caseVariants = []func(words []string) string{
+    toPascalCase,
+    toCamelCase,
+    toSnakeCase,
+    toUpperSnakeCase,
+    toKebabCase,
+}
+
+// expandCaseVariants returns keywords which also have case variants of each
+// keyword. e.g. app-name=my-service adds AppName=MyService, appName=myService,
+// app_name=my_service, APP_NAME=MY_SERVICE and app-name=my-service.
+// Keywords given explicitly are not overwritten by variants.
+func expandCaseVariants(keywords map[string]string) map[string]string {
+    expanded := map[string]string{}
+    for key, value := range keywords {
+        expanded[key] = value
+    }
+
+    keys := make([]string, 0, len(keywords))
+    for key := range keywords {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        keyWords := splitWords(key)
+        valueWords := splitWords(keywords[key])
+        if len(keyWords) == 0 {
+            continue
+        }
+
+        for _, variant := range caseVariants {
+            variantKey := variant(keyWords)
+            if _, ok := expanded[variantKey]; !ok {
+                expanded[variantKey] = variant(valueWords)
+            }
+        }
+    }
+
+    return expanded
+}
+
+// splitWords splits s into lower case words at separators(-, _, . and spaces)
+// and at case changes like myService or HTTPServer.
+func splitWords(s string) (words []string) {
+    runes := []rune(s)
+    start := 0
+
+    for i := 0; i <= len(runes); i++ {
+        if i == len(runes) || isWordSeparator(runes[i]) {
+            if start < i {
+                words = append(words, strings.ToLower(string(runes[start:i])))
+            }
+            start = i + 1
+            continue
+        }
+
+        if i > start && unicode.IsUpper(runes[i]) {
+            prev := runes[i - 1]
+            nextIsLower := i + 1 < len(runes) && unicode.IsLower(runes[i + 1])
+            if !unicode.IsUpper(prev) || nextIsLower {
+                words = append(words, strings.ToLower(string(runes[start:i])))
+                start = i
+            }
+        }
+    }
+
+    return
+}
+
+func isWordSeparator(r rune) bool {
+    return r == '-' || r == '_' || r == '.' || unicode.IsSpace(r)
+}
+
+func toPascalCase(words []string) string {
+    result := ""
+    for _, word := range words {
+        result += capitalize(word)
+    }
+    return result
+}
+
+func toCamelCase(words []string) string {
+    if len(words) == 0 {
+        return ""
+    }
+    return words[0] + toPascalCase(words[1:])
+}
+
+func toSnakeCase(words []string) string {
+    return strings.Join(words, "_")
+}
+
+func toUpperSnakeCase(words []string) string {
+    return strings.ToUpper(toSnakeCase(words))
+}
+
+func toKebabCase(words []string) string {
+    return strings.Join(words, "-")
+}
+
+func capitalize(word string) string {
+    runes := []rune(word)
+    if len(runes) == 0 {
+        return word
+    }
+    runes[0] = unicode.ToUpper(runes[0])
+    return string(runes)
+}
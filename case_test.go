@@ -0,0 +1,53 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func Test_splitWords(t *testing.T) {
+    cases := map[string]string{
+        "my-service": "my,service",
+        "my_service": "my,service",
+        "MyService": "my,service",
+        "myService": "my,service",
+        "MY_SERVICE": "my,service",
+        "HTTPServer": "http,server",
+        "name": "name",
+        "": "",
+    }
+    for s, expected := range cases {
+        assertString(t, "Verify words are split: " + s, expected, strings.Join(splitWords(s), ","))
+    }
+}
+
+func Test_expandCaseVariants(t *testing.T) {
+    m := expandCaseVariants(map[string]string{"app-name": "my-service"})
+    expected := map[string]string{
+        "app-name": "my-service",
+        "AppName": "MyService",
+        "appName": "myService",
+        "app_name": "my_service",
+        "APP_NAME": "MY_SERVICE",
+    }
+    if len(m) != len(expected) {
+        t.Error("Verify the number of variants", m)
+    }
+    for key, value := range expected {
+        assertString(t, "Verify a variant is derived: " + key, value, m[key])
+    }
+}
+
+func Test_expandCaseVariants_explicit(t *testing.T) {
+    m := expandCaseVariants(map[string]string{"app-name": "my-service", "APP_NAME": "EXPLICIT"})
+    assertString(t, "Verify an explicit keyword is kept", "EXPLICIT", m["APP_NAME"])
+    assertString(t, "Verify an explicit keyword is kept", "my-service", m["app-name"])
+}
+
+func Test_newReplaceFunc_caseVariants(t *testing.T) {
+    rf := newReplaceFunc(expandCaseVariants(map[string]string{"app-name": "my-service"}))
+    subPath, contents, _ := rf("cmd/app-name/app_name.go", "package app_name\ntype AppName struct{}\nvar APP_NAME = appName")
+    assertString(t, "Verify variants are replaced in a path", "cmd/my-service/my_service.go", subPath)
+    assertString(t, "Verify variants are replaced in contents",
+        "package my_service\ntype MyService struct{}\nvar MY_SERVICE = myService", contents)
+}
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 )
 
 // Exit codes are int values that represent an exit code for a particular error.
@@ -14,41 +16,106 @@ const (
 )
 
 const DefaultIncludeSuffixes = "*"
-const DefaultExcludeSuffixes = ".bin,.jpg,.jpeg,.png,.gif"
+const DefaultExcludeSuffixes = ""
+const DefaultSkipPatterns = ".git/"
 const DefaultKeySeparator = ","
+const DefaultConflictPolicy = ConflictFail
+const DefaultJobs = 1
+
+// paramsFlag is a flag which accumulates values of repeated options.
+type paramsFlag []string
+
+func (p *paramsFlag) String() string {
+	return strings.Join(*p, " ")
+}
+
+func (p *paramsFlag) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
 
 // CLI is the command line object
 type CLI struct {
 	// outStream and errStream are the stdout and stderr
 	// to write message from the CLI.
 	outStream, errStream io.Writer
+
+	// inStream is the stdin to read answers for prompts.
+	inStream io.Reader
 }
 
 // Run invokes the CLI with the given arguments.
 func (cli *CLI) Run(args []string) int {
+	if len(args) > 1 && args[1] == "update" {
+		return cli.runUpdate(args[1:])
+	}
+
 	var (
-		params    string
+		params    paramsFlag
 		arguments []string
 		version bool
         excludes string
         includes string
+        dryRun bool
+        onConflict string
+        engine string
+        caseVariants bool
+        noInput bool
+        paramsFile string
+        paramsEnv string
+        skips string
+        raws string
+        noBinaryDetect bool
+        jobs int
+        sourceType string
+        githubAPIURL string
+        ref string
+        tokenFile string
 	)
 
 	// Define option flag parse
 	flags := flag.NewFlagSet(Name, flag.ContinueOnError)
 	flags.SetOutput(cli.errStream)
 
-	flags.StringVar(&params, "params", "", "parameter for template files")
-	flags.StringVar(&params, "p", "", "parameter for template files(Short)")
+	flags.Var(&params, "params", "parameter for template files. Can be repeated")
+	flags.Var(&params, "p", "parameter for template files(Short)")
+
+    flags.StringVar(&paramsFile, "params-file", "", "YAML, JSON, TOML or .env file of parameters")
+    flags.StringVar(&paramsEnv, "params-env", "", "Prefix of environment variables used as parameters(e.g. APP_)")
 
 	flags.BoolVar(&version, "version", false, "Print version information and quit.")
 	flags.BoolVar(&version, "v", false, "Print version information and quit(Short).")
 
-    flags.StringVar(&includes, "includes", DefaultIncludeSuffixes, "Include filtering suffixes(e.g. .txt,.html)")
-    flags.StringVar(&includes, "i", DefaultIncludeSuffixes, "Include filtering suffixes")
+    flags.StringVar(&includes, "includes", DefaultIncludeSuffixes, "Include filtering patterns(e.g. .txt,*.html,cmd/**/*.go,re:^src/)")
+    flags.StringVar(&includes, "i", DefaultIncludeSuffixes, "Include filtering patterns")
+
+    flags.StringVar(&excludes, "excludes", DefaultExcludeSuffixes, "Exclude filtering patterns")
+    flags.StringVar(&excludes, "e", DefaultExcludeSuffixes, "Exclude filtering patterns")
+
+    flags.StringVar(&skips, "skip", DefaultSkipPatterns, "Patterns of files which are not generated")
+    flags.StringVar(&raws, "raw", "", "Patterns of files which are copied without replacement")
 
-    flags.StringVar(&excludes, "excludes", DefaultExcludeSuffixes, "Exclude filtering suffixes")
-    flags.StringVar(&excludes, "e", DefaultExcludeSuffixes, "Exclude filtering suffixes")
+    flags.BoolVar(&noBinaryDetect, "no-binary-detect", false, "Replace keywords in binary files too unless they are excluded")
+
+    flags.BoolVar(&dryRun, "dry-run", false, "Print the files to be generated without writing them")
+    flags.BoolVar(&dryRun, "n", false, "Print the files to be generated without writing them(Short)")
+
+    flags.StringVar(&onConflict, "on-conflict", DefaultConflictPolicy, "Policy for existing files(fail|skip|overwrite|backup|prompt)")
+
+    flags.StringVar(&engine, "engine", "", "Engine to render files(literal|template). engine: of a template or literal by default. *.tmpl files are always rendered by template")
+
+    flags.BoolVar(&caseVariants, "case-variants", false, "Replace case variants(e.g. AppName, app_name) of keywords too")
+    flags.BoolVar(&caseVariants, "c", false, "Replace case variants of keywords too(Short)")
+
+    flags.BoolVar(&noInput, "no-input", false, "Do not prompt for missing parameters")
+
+    flags.IntVar(&jobs, "jobs", DefaultJobs, "Number of files generated in parallel")
+    flags.IntVar(&jobs, "j", DefaultJobs, "Number of files generated in parallel(Short)")
+
+    flags.StringVar(&sourceType, "source-type", "", "Type of a template source(github|gitlab|bitbucket|git|archive|file). Detected from the source by default")
+    flags.StringVar(&githubAPIURL, "github-api-url", os.Getenv("GITHUB_API_URL"), "GitHub API URL(e.g. https://github.example.com/api/v3/)")
+    flags.StringVar(&ref, "ref", "", "Branch, tag or commit of a template repository")
+    flags.StringVar(&tokenFile, "token-file", "", "File which has a token for a private template repository")
 
 	// Parse commandline flag
 	if err := flags.Parse(args[1:]); err != nil {
@@ -67,7 +134,7 @@ func (cli *CLI) Run(args []string) int {
 	}
 
 	if len(arguments) != 2 {
-		fmt.Fprintln(cli.errStream, "gokeleton [-p params] <src-template> <dest-template>")
+		fmt.Fprintln(cli.errStream, "gokeleton [-n] [-p params] <src-template> <dest-template>")
 		return ExitCodeWrongArguments
 	}
 
@@ -76,7 +143,23 @@ func (cli *CLI) Run(args []string) int {
         Arguments: arguments,
         IncludeSuffixes: includes,
         ExcludeSuffixes: excludes,
-        KeySeparator: DefaultKeySeparator}
+        KeySeparator: DefaultKeySeparator,
+        DryRun: dryRun,
+        OnConflict: onConflict,
+        InStream: cli.inStream,
+        Engine: engine,
+        CaseVariants: caseVariants,
+        Interactive: !noInput && isTerminal(cli.inStream),
+        ParamsFile: paramsFile,
+        ParamsEnvPrefix: paramsEnv,
+        SkipPatterns: skips,
+        RawPatterns: raws,
+        NoBinaryDetect: noBinaryDetect,
+        Jobs: jobs,
+        SourceType: sourceType,
+        GithubAPIURL: githubAPIURL,
+        Ref: ref,
+        TokenFile: tokenFile}
 
 	err := StartMain(startParams)
     if err != nil {
@@ -85,3 +168,58 @@ func (cli *CLI) Run(args []string) int {
 
 	return ExitCodeOK
 }
+
+// runUpdate invokes the update subcommand with the given arguments.
+func (cli *CLI) runUpdate(args []string) int {
+	var params paramsFlag
+	var githubAPIURL string
+	var ref string
+	var tokenFile string
+
+	flags := flag.NewFlagSet(Name + " update", flag.ContinueOnError)
+	flags.SetOutput(cli.errStream)
+
+	flags.Var(&params, "params", "parameter to override recorded ones. Can be repeated")
+	flags.Var(&params, "p", "parameter to override recorded ones(Short)")
+
+	flags.StringVar(&githubAPIURL, "github-api-url", os.Getenv("GITHUB_API_URL"), "GitHub API URL(e.g. https://github.example.com/api/v3/)")
+	flags.StringVar(&ref, "ref", "", "Branch, tag or commit to update to")
+	flags.StringVar(&tokenFile, "token-file", "", "File which has a token for a private template repository")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return ExitCodeError
+	}
+
+	if flags.NArg() > 1 {
+		fmt.Fprintln(cli.errStream, "gokeleton update [-p params] [<dest-path>]")
+		return ExitCodeWrongArguments
+	}
+
+	destPath := "."
+	if flags.NArg() == 1 {
+		destPath = flags.Arg(0)
+	}
+
+	err := UpdateMain(UpdateParams{
+		Keywords: params,
+		KeySeparator: DefaultKeySeparator,
+		DestPath: destPath,
+		GithubAPIURL: githubAPIURL,
+		Ref: ref,
+		TokenFile: tokenFile})
+	if err != nil {
+		return ExitCodeError
+	}
+
+	return ExitCodeOK
+}
+
+// isTerminal returns true when r is a terminal.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fInfo, err := f.Stat()
+	return err == nil && fInfo.Mode() & os.ModeCharDevice != 0
+}
@@ -31,3 +31,23 @@ func TestRun_paramsFlag(t *testing.T) {
 	status := cli.Run(args)
 	_ = status
 }
+
+func TestRun_updateWrongArguments(t *testing.T) {
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	args := strings.Split("./gokeleton update a b", " ")
+
+	status := cli.Run(args)
+	if status != ExitCodeWrongArguments {
+		t.Errorf("expected %d to eq %d", status, ExitCodeWrongArguments)
+	}
+}
+
+func Test_paramsFlag(t *testing.T) {
+	var params paramsFlag
+	params.Set("foo=bar")
+	params.Set("a=b")
+	if len(params) != 2 || params[0] != "foo=bar" || params[1] != "a=b" {
+		t.Errorf("expected repeated params are accumulated: %v", params)
+	}
+}
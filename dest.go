@@ -0,0 +1,391 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// Conflict policies decide what happens when a generated file already exists.
+const (
+    ConflictFail = "fail"
+    ConflictSkip = "skip"
+    ConflictOverwrite = "overwrite"
+    ConflictBackup = "backup"
+    ConflictPrompt = "prompt"
+)
+
+const backupSuffix = ".orig"
+
+var errDryRunConflict = errors.New("Some files already exist")
+
+// errSkipped is returned by fileDestAccess when a file is not written by
+// a conflict policy, so that a caller doesn't record it as generated.
+var errSkipped = errors.New("A file is skipped by a conflict policy")
+
+// defaultFileMode is used when a source doesn't have permission bits.
+const defaultFileMode os.FileMode = 0666
+
+type fileDestAccess struct {
+    destPath string
+    onConflict string
+    prompter *prompter
+    report func(action string, path string)
+    // journal records changes to roll back. It is nil when not needed.
+    journal *journal
+}
+
+type memoryFile struct {
+    subPath string
+    contents []byte
+    mode os.FileMode
+}
+
+type memoryLink struct {
+    subPath string
+    target string
+}
+
+type memoryDestAccess struct {
+    dirs []string
+    files []memoryFile
+    links []memoryLink
+}
+
+type plannedEntry struct {
+    subPath string
+    isDir bool
+    size int64
+    mode os.FileMode
+    linkTarget string
+    replaced bool
+    action string
+}
+
+type dryRunDestAccess struct {
+    destPath string
+    onConflict string
+    entries []plannedEntry
+}
+
+func newFileDestAccess(destPath string, onConflict string, p *prompter) (da *fileDestAccess) {
+    da = new(fileDestAccess)
+    da.destPath = destPath
+    da.onConflict = onConflict
+    da.prompter = p
+    da.report = printReport
+    return
+}
+
+func newMemoryDestAccess() *memoryDestAccess {
+    return new(memoryDestAccess)
+}
+
+func newDryRunDestAccess(destPath string, onConflict string) (da *dryRunDestAccess) {
+    da = new(dryRunDestAccess)
+    da.destPath = destPath
+    da.onConflict = onConflict
+    return
+}
+
+func checkConflictPolicy(policy string) error {
+    switch policy {
+    case ConflictFail, ConflictSkip, ConflictOverwrite, ConflictBackup, ConflictPrompt:
+        return nil
+    }
+    return errors.New("Unknown conflict policy: " + policy)
+}
+
+// DestAccess
+func (da *fileDestAccess) MakeDir(subPath string) error {
+    dirPath := normalizePath(da.destPath, true) + subPath
+    if err := checkSymlinkParents(da.destPath, subPath, true); err != nil {
+        return err
+    }
+
+    // Record directories from the outermost one which doesn't exist.
+    var created []string
+    for path := filepath.Clean(dirPath); da.journal != nil; path = filepath.Dir(path) {
+        if _, err := os.Lstat(path); err == nil || path == filepath.Dir(path) {
+            break
+        }
+        created = append([]string{path}, created...)
+    }
+
+    err := os.MkdirAll(dirPath, 0777)
+    for _, path := range created {
+        da.journal.created(path)
+    }
+    return err
+}
+
+func (da *fileDestAccess) WriteFile(subPath string, reader io.Reader, mode os.FileMode, replaced bool) error {
+    newFilePath := da.filePath(subPath)
+    if err := checkSymlinkParents(da.destPath, subPath, false); err != nil {
+        return err
+    }
+
+    action, err := da.resolveConflict(newFilePath)
+    if err != nil {
+        return err
+    }
+    if action == "Skip" {
+        da.report(action, newFilePath)
+        return errSkipped
+    }
+
+    perm := filePerm(mode)
+    if action == "Overwrite" || isSymlink(newFilePath) {
+        // Replace a link itself instead of a file it points to, and keep
+        // an original file to roll back.
+        if err = da.journal.moveAside(newFilePath); err != nil {
+            return err
+        }
+    }
+
+    out, err := os.OpenFile(newFilePath, os.O_WRONLY | os.O_CREATE | os.O_TRUNC, perm)
+    if err != nil {
+        return err
+    }
+    defer out.Close()
+    da.journal.created(newFilePath)
+
+    // The file is always created here because an existing one is moved
+    // aside, so that perm is masked by umask like other tools.
+    _, err = io.Copy(out, reader)
+    if err == nil {
+        da.report(action, newFilePath)
+    }
+
+    return err
+}
+
+func (da *fileDestAccess) Symlink(subPath string, target string) error {
+    newFilePath := da.filePath(subPath)
+    if err := checkSymlinkParents(da.destPath, subPath, false); err != nil {
+        return err
+    }
+
+    action, err := da.resolveConflict(newFilePath)
+    if err != nil {
+        return err
+    }
+    if action == "Skip" {
+        da.report(action, newFilePath)
+        return errSkipped
+    }
+
+    if isExistingFile(newFilePath) {
+        if err = da.journal.moveAside(newFilePath); err != nil {
+            return err
+        }
+    }
+
+    err = os.Symlink(target, newFilePath)
+    if err == nil {
+        da.journal.created(newFilePath)
+        da.report(action, newFilePath + " -> " + target)
+    }
+    return err
+}
+
+// checkSymlinkParents returns an error when a directory of subPath in
+// destPath is a symbolic link, so that nothing is written out of destPath
+// through a link. subPath itself is checked too when self is true.
+func checkSymlinkParents(destPath string, subPath string, self bool) error {
+    elements := strings.Split(filepath.ToSlash(filepath.Clean(subPath)), "/")
+    if !self {
+        elements = elements[:len(elements) - 1]
+    }
+
+    path := destPath
+    for _, element := range elements {
+        if element == "" || element == "." {
+            continue
+        }
+        path = filepath.Join(path, element)
+        if info, err := os.Lstat(path); err == nil && info.Mode() & os.ModeSymlink != 0 {
+            return errors.New("Refuse to write through a symbolic link: " + path)
+        }
+    }
+    return nil
+}
+
+func (da *fileDestAccess) filePath(subPath string) string {
+    // This is expected to be created before calling here.
+    // Or, ignore error for a dest file is used.
+    isDestDir, _ := isDirectory(da.destPath)
+    return normalizePath(da.destPath, isDestDir) + subPath
+}
+
+// resolveConflict applies the conflict policy to an existing file and
+// returns the action to report for it.
+func (da *fileDestAccess) resolveConflict(path string) (action string, err error) {
+    if !isExistingFile(path) {
+        return "Create", nil
+    }
+
+    switch da.onConflict {
+    case ConflictSkip:
+        return "Skip", nil
+    case ConflictOverwrite:
+        return "Overwrite", nil
+    case ConflictBackup:
+        backupPath := path + backupSuffix
+        for i := 1; isExistingFile(backupPath); i++ {
+            backupPath = path + backupSuffix + "." + strconv.Itoa(i)
+        }
+        if err = os.Rename(path, backupPath); err != nil {
+            return "", err
+        }
+        da.journal.moved(path, backupPath)
+        return "Backup", nil
+    case ConflictPrompt:
+        yes, err := da.prompter.confirm("Overwrite " + path + "?")
+        if err != nil {
+            return "", err
+        }
+        if yes {
+            return "Overwrite", nil
+        }
+        return "Skip", nil
+    }
+
+    return "", &os.PathError{Op: "create", Path: path, Err: os.ErrExist}
+}
+
+// DestAccess
+func (da *memoryDestAccess) MakeDir(subPath string) error {
+    da.dirs = append(da.dirs, subPath)
+    return nil
+}
+
+func (da *memoryDestAccess) WriteFile(subPath string, reader io.Reader, mode os.FileMode, replaced bool) error {
+    contents, err := ioutil.ReadAll(reader)
+    if err != nil {
+        return err
+    }
+    da.files = append(da.files, memoryFile{subPath: subPath, contents: contents, mode: mode})
+    return nil
+}
+
+func (da *memoryDestAccess) Symlink(subPath string, target string) error {
+    da.links = append(da.links, memoryLink{subPath: subPath, target: target})
+    return nil
+}
+
+// DestAccess
+func (da *dryRunDestAccess) MakeDir(subPath string) error {
+    da.entries = append(da.entries, plannedEntry{subPath: subPath, isDir: true, action: "Dir"})
+    return nil
+}
+
+func (da *dryRunDestAccess) WriteFile(subPath string, reader io.Reader, mode os.FileMode, replaced bool) error {
+    size, err := io.Copy(ioutil.Discard, reader)
+    if err != nil {
+        return err
+    }
+
+    da.entries = append(da.entries, plannedEntry{subPath: subPath, size: size, mode: mode, replaced: replaced, action: da.conflictAction(subPath)})
+    return nil
+}
+
+func (da *dryRunDestAccess) Symlink(subPath string, target string) error {
+    da.entries = append(da.entries, plannedEntry{subPath: subPath, linkTarget: target, action: da.conflictAction(subPath)})
+    return nil
+}
+
+// conflictAction returns an action which the conflict policy will take.
+func (da *dryRunDestAccess) conflictAction(subPath string) string {
+    if !isExistingFile(da.filePath(subPath)) {
+        return "Create"
+    }
+
+    switch da.onConflict {
+    case ConflictSkip:
+        return "Skip"
+    case ConflictOverwrite:
+        return "Overwrite"
+    case ConflictBackup:
+        return "Backup"
+    case ConflictPrompt:
+        return "Prompt"
+    }
+    return "Conflict"
+}
+
+// hasConflict returns true when a planned file fails by the fail policy.
+func (da *dryRunDestAccess) hasConflict() bool {
+    for _, entry := range da.entries {
+        if entry.action == "Conflict" {
+            return true
+        }
+    }
+    return false
+}
+
+// report writes every planned directory and file to w.
+func (da *dryRunDestAccess) report(w io.Writer) {
+    for _, entry := range da.entries {
+        if entry.isDir {
+            fmt.Fprintln(w, entry.action, normalizePath(da.destPath, true) + entry.subPath)
+            continue
+        }
+
+        if entry.linkTarget != "" {
+            fmt.Fprintf(w, "%s %s -> %s\n", entry.action, da.filePath(entry.subPath), entry.linkTarget)
+            continue
+        }
+
+        replaced := "verbatim"
+        if entry.replaced {
+            replaced = "replaced"
+        }
+        fmt.Fprintf(w, "%s %s (%d bytes, %s, %s)\n", entry.action, da.filePath(entry.subPath), entry.size, replaced, entry.mode.Perm())
+    }
+}
+
+// filePath returns a dest file path. The dest path is handled as a directory
+// when it exists as a directory or when a directory is planned for it.
+func (da *dryRunDestAccess) filePath(subPath string) string {
+    isDestDir, _ := isDirectory(da.destPath)
+    isDestDir = isDestDir || (len(da.entries) > 0 && da.entries[0].isDir)
+    return normalizePath(da.destPath, isDestDir) + subPath
+}
+
+func printReport(action string, path string) {
+    fmt.Println(action, path)
+}
+
+func isExistingFile(path string) bool {
+    fInfo, err := os.Lstat(path)
+    return err == nil && !fInfo.IsDir()
+}
+
+// filePerm returns permission bits of a mode, or defaultFileMode if it has none.
+func filePerm(mode os.FileMode) os.FileMode {
+    if mode.Perm() == 0 {
+        return defaultFileMode
+    }
+    return mode.Perm()
+}
+
+// execPerm returns permission bits of an existing file whose execute bits
+// follow perm. Other bits are kept to respect umask and local changes.
+func execPerm(current os.FileMode, perm os.FileMode) os.FileMode {
+    current = current.Perm()
+    if perm & 0111 == 0 {
+        return current &^ 0111
+    }
+    return current | (current & 0444) >> 2
+}
+
+func isSymlink(path string) bool {
+    fInfo, err := os.Lstat(path)
+    return err == nil && fInfo.Mode() & os.ModeSymlink != 0
+}
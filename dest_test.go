@@ -0,0 +1,278 @@
+package main
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func newTemplateDir(t *testing.T, files map[string]string) string {
+    dir, err := ioutil.TempDir("", "gokeleton-src")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for name, contents := range files {
+        path := filepath.Join(dir, name)
+        os.MkdirAll(filepath.Dir(path), 0777)
+        if err = ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return dir
+}
+
+func Test_dryRunDestAccess_copyEachFileSource(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{"foo/foo.txt": "foo,foo", "foo.png": "foo"})
+    defer os.RemoveAll(srcDir)
+    destDir := filepath.Join(os.TempDir(), "gokeleton-dry-run-not-created")
+
+    da := newDryRunDestAccess(destDir, ConflictFail)
+    err := copyEachFileSource(newFileAccess(srcDir), da, newTestFilter(t, "*", ".png"), newReplaceFunc(map[string]string{"foo": "hoge"}), nil)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+
+    if _, err = os.Stat(destDir); !os.IsNotExist(err) {
+        t.Error("Verify dry run does not create dest path")
+    }
+
+    var found bool
+    for _, entry := range da.entries {
+        if entry.subPath == "hoge/hoge.txt" {
+            found = true
+            if entry.size != int64(len("hoge,hoge")) || !entry.replaced {
+                t.Error("Verify replaced size is recorded.", entry)
+            }
+        }
+        if entry.subPath == "foo.png" && (entry.replaced || entry.size != 3) {
+            t.Error("Verify excluded file is recorded as verbatim.", entry)
+        }
+    }
+    if !found {
+        t.Error("Verify replaced sub path is recorded.")
+    }
+}
+
+func Test_copyEachFileSource_modeAndSymlink(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{"scripts/foo.sh": "echo foo", "foo.txt": "foo"})
+    defer os.RemoveAll(srcDir)
+    os.Chmod(filepath.Join(srcDir, "scripts", "foo.sh"), 0755)
+    os.Symlink("foo.txt", filepath.Join(srcDir, "foo-link"))
+    os.Mkdir(filepath.Join(srcDir, "empty"), 0777)
+
+    da := newMemoryDestAccess()
+    err := copyEachFileSource(newFileAccess(srcDir), da, newTestFilter(t, "*", ""), newReplaceFunc(map[string]string{"foo": "bar"}), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for _, file := range da.files {
+        if file.subPath == "scripts/bar.sh" && file.mode.Perm() != 0755 {
+            t.Error("Verify a file mode is kept.", file.mode)
+        }
+    }
+    if len(da.links) != 1 {
+        t.Fatal("Verify a symlink is not followed.", da.links)
+    }
+    assertString(t, "Verify a link path is replaced", "bar-link", da.links[0].subPath)
+    assertString(t, "Verify a link target is replaced", "bar.txt", da.links[0].target)
+
+    foundEmpty := false
+    for _, dir := range da.dirs {
+        foundEmpty = foundEmpty || dir == "empty"
+    }
+    if !foundEmpty {
+        t.Error("Verify an empty directory is created.", da.dirs)
+    }
+}
+
+func Test_StartMain_dryRunConflict(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{"a.txt": "a"})
+    defer os.RemoveAll(srcDir)
+    destDir := newTemplateDir(t, map[string]string{"a.txt": "old"})
+    defer os.RemoveAll(destDir)
+
+    params := StartParams{KeySeparator: ",", Arguments: []string{srcDir, destDir}, IncludeSuffixes: "*", DryRun: true}
+    if err := StartMain(params); err != errDryRunConflict {
+        t.Error("Verify a conflict by the fail policy is an error.", err)
+    }
+    params.OnConflict = ConflictSkip
+    if err := StartMain(params); err != nil {
+        t.Error("Verify a conflict by the skip policy is not an error.", err)
+    }
+    assertString(t, "Verify an existing file is kept", "old", readTestFile(filepath.Join(destDir, "a.txt")))
+}
+
+func Test_dryRunDestAccess_report(t *testing.T) {
+    da := newDryRunDestAccess("/tmp/gokeleton-dest-not-found", ConflictFail)
+    da.MakeDir("")
+    da.WriteFile("a.txt", strings.NewReader("abc"), 0644, true)
+
+    out := new(bytes.Buffer)
+    da.report(out)
+    if !strings.Contains(out.String(), "Dir /tmp/gokeleton-dest-not-found/\n") {
+        t.Error("Verify dir is reported.", out.String())
+    }
+    if !strings.Contains(out.String(), "Create /tmp/gokeleton-dest-not-found/a.txt (3 bytes, replaced, -rw-r--r--)") {
+        t.Error("Verify file is reported.", out.String())
+    }
+}
+
+func Test_fileDestAccess_WriteFile(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+
+    da := newFileDestAccess(destDir, ConflictFail, nil)
+    if err := da.MakeDir("sub"); err != nil {
+        t.Error("Verify MakeDir works.", err)
+    }
+    if err := da.WriteFile("sub/a.txt", strings.NewReader("abc"), 0644, true); err != nil {
+        t.Error("Verify WriteFile works.", err)
+    }
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "sub", "a.txt"))
+    assertString(t, "Verify file contents are written", "abc", string(contents))
+}
+
+func Test_fileDestAccess_WriteFile_mode(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+
+    da := newFileDestAccess(destDir, ConflictFail, nil)
+    if err := da.WriteFile("build.sh", strings.NewReader("#!/bin/sh\n"), 0755, true); err != nil {
+        t.Error("Verify WriteFile works.", err)
+    }
+    info, _ := os.Stat(filepath.Join(destDir, "build.sh"))
+    if info == nil || info.Mode().Perm() != 0755 {
+        t.Error("Verify an executable bit is kept.", info)
+    }
+}
+
+func Test_fileDestAccess_WriteFile_umask(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+    ioutil.WriteFile(filepath.Join(destDir, "expected.txt"), []byte("a"), 0666)
+    expected, _ := os.Stat(filepath.Join(destDir, "expected.txt"))
+
+    da := newFileDestAccess(destDir, ConflictFail, nil)
+    da.WriteFile("a.txt", strings.NewReader("a"), 0666, true)
+    info, _ := os.Stat(filepath.Join(destDir, "a.txt"))
+    if info == nil || info.Mode().Perm() != expected.Mode().Perm() {
+        t.Error("Verify umask is applied to a mode.", info, expected.Mode())
+    }
+}
+
+func Test_execPerm(t *testing.T) {
+    assertString(t, "Verify execute bits are added where read bits are", "-rwxr-x---", execPerm(0640, 0755).String())
+    assertString(t, "Verify execute bits are removed", "-rw-r-----", execPerm(0750, 0644).String())
+}
+
+func Test_fileDestAccess_Symlink(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+
+    da := newFileDestAccess(destDir, ConflictFail, nil)
+    if err := da.Symlink("link.txt", "a.txt"); err != nil {
+        t.Error("Verify Symlink works.", err)
+    }
+    target, _ := os.Readlink(filepath.Join(destDir, "link.txt"))
+    assertString(t, "Verify a link target", "a.txt", target)
+
+    if err := da.Symlink("link.txt", "b.txt"); !os.IsExist(err) {
+        t.Error("Verify an existing link is a conflict.", err)
+    }
+}
+
+func Test_fileDestAccess_symlinkParent(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+    outsideDir, _ := ioutil.TempDir("", "gokeleton-outside")
+    defer os.RemoveAll(outsideDir)
+    os.Symlink(outsideDir, filepath.Join(destDir, "s"))
+
+    da := newFileDestAccess(destDir, ConflictFail, nil)
+    if err := da.WriteFile("s/pwn.txt", strings.NewReader("pwn"), 0644, true); err == nil {
+        t.Error("Verify a file under a symbolic link is an error.")
+    }
+    if err := da.MakeDir("s/x"); err == nil {
+        t.Error("Verify a directory under a symbolic link is an error.")
+    }
+    if err := da.Symlink("s/link", "a.txt"); err == nil {
+        t.Error("Verify a link under a symbolic link is an error.")
+    }
+    if files, _ := ioutil.ReadDir(outsideDir); len(files) != 0 {
+        t.Error("Verify nothing is written out of a dest path.", files)
+    }
+}
+
+func writeConflictFile(t *testing.T, policy string, p *prompter) (destDir string, err error) {
+    destDir, _ = ioutil.TempDir("", "gokeleton-dest")
+    ioutil.WriteFile(filepath.Join(destDir, "a.txt"), []byte("old"), 0666)
+
+    da := newFileDestAccess(destDir, policy, p)
+    err = da.WriteFile("a.txt", strings.NewReader("new"), 0644, true)
+    return
+}
+
+func Test_fileDestAccess_WriteFile_conflictFail(t *testing.T) {
+    destDir, err := writeConflictFile(t, ConflictFail, nil)
+    defer os.RemoveAll(destDir)
+    if !os.IsExist(err) {
+        t.Error("Verify an existing file is reported as an error.", err)
+    }
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+    assertString(t, "Verify an existing file is kept", "old", string(contents))
+}
+
+func Test_fileDestAccess_WriteFile_conflictSkip(t *testing.T) {
+    destDir, err := writeConflictFile(t, ConflictSkip, nil)
+    defer os.RemoveAll(destDir)
+    if err != errSkipped {
+        t.Error("Verify a skipped file is reported to a caller", err)
+    }
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+    assertString(t, "Verify an existing file is kept", "old", string(contents))
+}
+
+func Test_fileDestAccess_WriteFile_conflictOverwrite(t *testing.T) {
+    destDir, err := writeConflictFile(t, ConflictOverwrite, nil)
+    defer os.RemoveAll(destDir)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+    assertString(t, "Verify an existing file is overwritten", "new", string(contents))
+}
+
+func Test_fileDestAccess_WriteFile_conflictBackup(t *testing.T) {
+    destDir, err := writeConflictFile(t, ConflictBackup, nil)
+    defer os.RemoveAll(destDir)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+    assertString(t, "Verify an existing file is overwritten", "new", string(contents))
+    contents, _ = ioutil.ReadFile(filepath.Join(destDir, "a.txt" + backupSuffix))
+    assertString(t, "Verify an existing file is backed up", "old", string(contents))
+}
+
+func Test_fileDestAccess_WriteFile_conflictPrompt(t *testing.T) {
+    destDir, err := writeConflictFile(t, ConflictPrompt, newPrompter(strings.NewReader("y\n"), new(bytes.Buffer)))
+    defer os.RemoveAll(destDir)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+    assertString(t, "Verify an existing file is overwritten by the answer", "new", string(contents))
+}
+
+func Test_checkConflictPolicy(t *testing.T) {
+    if checkConflictPolicy(ConflictBackup) != nil {
+        t.Error("Verify backup is a known policy")
+    }
+    if checkConflictPolicy("merge") == nil {
+        t.Error("Verify an unknown policy is an error")
+    }
+}
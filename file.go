@@ -34,14 +34,27 @@ func newFileSource(srcPath string, subPath string, info os.FileInfo) (fs *fileSo
 
 // SourceAccess
 func (fa *fileAccess) EachSource(callback FileSourceFunc) error {
+    rules := new(ignoreRules)
+    ignorePath := fa.srcPath + ignoreFileName
+    if info, err := os.Stat(ignorePath); err == nil && !info.IsDir() {
+        rules = readIgnore(newFileSource(ignorePath, ignoreFileName, info))
+    }
+
     return filepath.Walk(fa.srcPath, func (fullPath string, info os.FileInfo, err error) error {
         if err != nil {
             return err
         }
 
         subPath := toSubPath(fa.srcPath, fullPath)
+        if rules.isIgnored(subPath, info.IsDir()) {
+            if info.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+
         err = callback(newFileSource(fullPath, subPath, info))
-        if err != nil {
+        if err != nil && err != errStopEachSource && err != filepath.SkipDir {
             fmt.Println("EachSource return error:", err)
         }
         return err
@@ -60,3 +73,11 @@ func (fs *fileSource) IsDir() bool {
 func (fs *fileSource) Reader() (io.ReadCloser, error) {
     return os.Open(fs.fullPath)
 }
+
+func (fs *fileSource) Mode() os.FileMode {
+    return fs.info.Mode()
+}
+
+func (fs *fileSource) LinkTarget() (string, error) {
+    return os.Readlink(fs.fullPath)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+    "errors"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+)
+
+// gitDirName is never generated from a cloned template.
+const gitDirName = ".git"
+
+// gitAccess reads a template from a git remote. A ref is fetched into
+// a temporary directory with depth 1 and walked like a local directory.
+type gitAccess struct {
+    remote string
+    subPath string
+    ref string
+    cloneDir string
+    revision string
+    fa *fileAccess
+}
+
+// newGitAccess accepts a remote URL followed by //<path> for a template
+// under a directory of a repository.
+func newGitAccess(src string, config *sourceConfig) (ga *gitAccess) {
+    if config == nil {
+        config = new(sourceConfig)
+    }
+
+    ga = new(gitAccess)
+    ga.remote, ga.subPath = splitSubPath(src)
+    if !isRemoteSource(ga.remote) {
+        // git runs in a temporary directory.
+        if absPath, err := filepath.Abs(ga.remote); err == nil {
+            ga.remote = absPath
+        }
+    }
+    ga.ref = config.ref
+    return
+}
+
+// isRemoteSource returns true when src is not a local path.
+func isRemoteSource(src string) bool {
+    return strings.Contains(src, "://") || strings.HasPrefix(src, "git@")
+}
+
+// isGitSource returns true for remotes like git@host:org/repo.git,
+// ssh://, git://, file:// and *.git.
+func isGitSource(src string) bool {
+    remote, _ := splitSubPath(src)
+    for _, prefix := range []string{"git@", "ssh://", "git://", "file://"} {
+        if strings.HasPrefix(remote, prefix) {
+            return true
+        }
+    }
+    return strings.HasSuffix(remote, ".git")
+}
+
+// splitSubPath splits src into a location and a path after "//". "//" of
+// a scheme like https:// is not a separator.
+func splitSubPath(src string) (location string, subPath string) {
+    start := 0
+    if index := strings.Index(src, "://"); index != -1 {
+        start = index + len("://")
+    }
+
+    index := strings.Index(src[start:], "//")
+    if index == -1 {
+        return src, ""
+    }
+    return src[:start + index], strings.Trim(src[start + index + 2:], "/")
+}
+
+// SourceAccess
+func (ga *gitAccess) EachSource(callback FileSourceFunc) error {
+    err := ga.clone()
+    if err != nil {
+        return err
+    }
+
+    return ga.fa.EachSource(func(fileSource FileSource) error {
+        if fileSource.IsDir() && fileSource.SubPath() == gitDirName {
+            return filepath.SkipDir
+        }
+        return callback(fileSource)
+    })
+}
+
+func (ga *gitAccess) clone() (err error) {
+    if ga.fa != nil {
+        return nil
+    }
+
+    ga.cloneDir, err = ioutil.TempDir("", "gokeleton-git")
+    if err != nil {
+        return err
+    }
+    defer func() {
+        if err != nil {
+            ga.Close()
+        }
+    }()
+
+    // A commit can be fetched as well as a branch and a tag
+    // while clone --branch accepts only branches and tags.
+    ref := ga.ref
+    if ref == "" {
+        ref = "HEAD"
+    }
+    commands := [][]string{
+        {"init", "--quiet"},
+        {"remote", "add", "origin", ga.remote},
+        {"fetch", "--quiet", "--depth", "1", "origin", ref},
+        {"checkout", "--quiet", "FETCH_HEAD"},
+    }
+    for _, args := range commands {
+        if _, err = ga.git(args...); err != nil {
+            return err
+        }
+    }
+
+    revision, err := ga.git("rev-parse", "HEAD")
+    if err != nil {
+        return err
+    }
+    ga.revision = strings.TrimSpace(revision)
+
+    srcPath := filepath.Join(ga.cloneDir, filepath.FromSlash(ga.subPath))
+    if isDir, _ := isDirectory(srcPath); !isDir {
+        return errors.New("No directory " + ga.subPath + " in " + ga.remote)
+    }
+    ga.fa = newFileAccess(srcPath)
+    return nil
+}
+
+// git runs a git command in the clone directory and returns its output.
+func (ga *gitAccess) git(args ...string) (string, error) {
+    cmd := exec.Command("git", args...)
+    cmd.Dir = ga.cloneDir
+    // Never ask a user for a credential.
+    cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+    out, err := cmd.CombinedOutput()
+    if err != nil {
+        return "", errors.New("git " + strings.Join(args, " ") + ": " + strings.TrimSpace(string(out)) + ": " + err.Error())
+    }
+    return string(out), nil
+}
+
+// Close removes a cloned directory.
+func (ga *gitAccess) Close() error {
+    if ga.cloneDir == "" {
+        return nil
+    }
+
+    err := os.RemoveAll(ga.cloneDir)
+    ga.cloneDir = ""
+    ga.fa = nil
+    return err
+}
+
+// SourceRevision
+func (ga *gitAccess) Revision() string {
+    return ga.revision
+}
+
+func (ga *gitAccess) ArchiveHash() string {
+    return ""
+}
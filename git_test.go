@@ -0,0 +1,102 @@
+package main
+
+import (
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "testing"
+)
+
+// newTestGitRepo creates a repository which has files in a commit tagged v1
+// and one more commit on the default branch.
+func newTestGitRepo(t *testing.T) string {
+    if _, err := exec.LookPath("git"); err != nil {
+        t.Skip("git is not found")
+    }
+
+    repoDir := newTemplateDir(t, map[string]string{"foo.txt": "foo", "sub/bar.txt": "bar"})
+    git := func(args ...string) {
+        cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+        cmd.Dir = repoDir
+        if out, err := cmd.CombinedOutput(); err != nil {
+            t.Fatal(string(out), err)
+        }
+    }
+    git("init", "--quiet")
+    git("add", ".")
+    git("commit", "--quiet", "-m", "v1")
+    git("tag", "v1")
+    ioutil.WriteFile(filepath.Join(repoDir, "added.txt"), []byte("added"), 0666)
+    git("add", ".")
+    git("commit", "--quiet", "-m", "v2")
+    return repoDir
+}
+
+func Test_gitAccess_EachSource(t *testing.T) {
+    repoDir := newTestGitRepo(t)
+    defer os.RemoveAll(repoDir)
+
+    ga := newGitAccess("file://" + repoDir, nil)
+    defer ga.Close()
+    assertString(t, "Verify files of the default branch without .git", ",added.txt,foo.txt,sub,sub/bar.txt", collectSubPaths(t, ga))
+    if len(ga.Revision()) != 40 {
+        t.Error("Verify a commit is a revision.", ga.Revision())
+    }
+
+    cloneDir := ga.cloneDir
+    ga.Close()
+    if _, err := os.Stat(cloneDir); !os.IsNotExist(err) {
+        t.Error("Verify a cloned directory is removed.", err)
+    }
+}
+
+func Test_gitAccess_refAndSubPath(t *testing.T) {
+    repoDir := newTestGitRepo(t)
+    defer os.RemoveAll(repoDir)
+
+    ga := newGitAccess("file://" + repoDir + "//sub", &sourceConfig{ref: "v1"})
+    defer ga.Close()
+    assertString(t, "Verify files under a path of a tag", ",bar.txt", collectSubPaths(t, ga))
+
+    ga = newGitAccess("file://" + repoDir, &sourceConfig{ref: "unknown"})
+    defer ga.Close()
+    if err := ga.EachSource(func(fileSource FileSource) error { return nil }); err == nil {
+        t.Error("Verify an unknown ref is an error.")
+    }
+}
+
+func Test_isGitSource(t *testing.T) {
+    for _, src := range []string{"git@gitlab.example.com:org/repo.git", "ssh://git@host/org/repo", "file:///path/repo.git", "https://gitea.example.com/org/repo.git//templates"} {
+        if !isGitSource(src) {
+            t.Error("Verify a git source", src)
+        }
+    }
+    for _, src := range []string{"https://github.com/hata/gorep", "/local/template"} {
+        if isGitSource(src) {
+            t.Error("Verify not a git source", src)
+        }
+    }
+}
+
+func Test_splitSubPath(t *testing.T) {
+    location, subPath := splitSubPath("https://gitlab.example.com/org/repo.git//templates/app/")
+    assertString(t, "Verify a location", "https://gitlab.example.com/org/repo.git", location)
+    assertString(t, "Verify a sub path", "templates/app", subPath)
+
+    location, subPath = splitSubPath("file:///path/repo.git")
+    assertString(t, "Verify a location of file://", "file:///path/repo.git", location)
+    assertString(t, "Verify no sub path", "", subPath)
+}
+
+func Test_newSourceAccess_git(t *testing.T) {
+    if _, ok := newSourceAccess("https://gitlab.example.com/org/repo", nil).(*gitAccess); !ok {
+        t.Error("Verify a non GitHub host is a git source.")
+    }
+    if _, ok := newSourceAccess("https://github.example.com/org/repo", &sourceConfig{githubAPIURL: "https://github.example.com/api/v3"}).(*githubAccess); !ok {
+        t.Error("Verify a GitHub Enterprise host is GitHub.")
+    }
+    if _, ok := newSourceAccess("git@github.com:hata/gorep.git", nil).(*gitAccess); !ok {
+        t.Error("Verify an ssh remote is a git source.")
+    }
+}
@@ -2,41 +2,70 @@ package main
 
 import (
     "archive/zip"
-    "bytes"
     "errors"
     "github.com/google/go-github/github"
     "io"
-    "io/ioutil"
     "net/http"
     "net/url"
+    "os"
     "strings"
+    "time"
 )
 
+// defaultGithubHost is the host of template URLs which is always accepted.
+const defaultGithubHost = "github.com"
+
 type githubAccess struct {
     client *github.Client
+    httpClient *http.Client
+    auth *tokenTransport
+    tokenFile string
+    apiURL string
     url string
+    host string
     owner string
     repos string
     basePath string
+    // ref is a branch, a tag or a commit. An empty ref is the default branch.
+    ref string
+    refCandidates []sourceRef
+    revision string
+    archiveHash string
+    zipReader *zip.Reader
+    zipFile *os.File
 }
 
-type githubFileSource struct {
-    file *zip.File
-    path string
-}
+func newGithubAccess(githubHTMLURL string, config *sourceConfig) (ga *githubAccess) {
+    if config == nil {
+        config = new(sourceConfig)
+    }
 
-func newGithubAccess(githubHTMLURL string) (ga *githubAccess) {
     ga = new(githubAccess)
-    ga.client = github.NewClient(nil)
+    ga.httpClient, ga.auth = newTokenClient(config.httpClient, "Authorization", "token ")
+    ga.client = github.NewClient(ga.httpClient)
+    ga.auth.host = ga.client.BaseURL.Host
+    ga.tokenFile = config.tokenFile
+    ga.apiURL = config.githubAPIURL
+    ga.ref = config.ref
     ga.url = githubHTMLURL
     return
 }
 
-func newGithubFileSource(zipFile *zip.File, path string) (gf *githubFileSource) {
-    gf = new(githubFileSource)
-    gf.file = zipFile
-    gf.path = path
-    return
+// isGithubURL returns true when a host of src is GitHub or a GitHub
+// Enterprise host of the configured API URL.
+func isGithubURL(src string, config *sourceConfig) bool {
+    srcURL, err := url.Parse(src)
+    if err != nil {
+        return false
+    }
+    if srcURL.Host == defaultGithubHost {
+        return true
+    }
+    if config == nil || config.githubAPIURL == "" {
+        return false
+    }
+    apiURL, err := url.Parse(config.githubAPIURL)
+    return err == nil && apiURL.Host == srcURL.Host
 }
 
 // SourceAccess
@@ -46,108 +75,190 @@ func (ga *githubAccess) EachSource(callback FileSourceFunc) (err error) {
         return err
     }
 
-    for _, f := range zipReader.File {
-        name := f.Name
-        index := strings.Index(name, "/")
-        if index != -1 {
-            name = name[index + 1:]
-        }
-        baseLen := len(ga.basePath)
-        if baseLen > 0 {
-            index = strings.Index(name, ga.basePath)
-            if index != 0 {
-                continue
-            }
-            name = name[baseLen + 1:]
-        }
-
-        // Check file should be called or not
-        err = callback(newGithubFileSource(f, name))
-        if err != nil {
-            return err
-        }
-    }
-
-    return nil
-}
-
-// FileSource
-func (gf *githubFileSource) SubPath() string {
-    return gf.path
-}
-
-func (gf *githubFileSource) IsDir() bool {
-    return gf.file.FileInfo().IsDir()
-}
-
-func (gf *githubFileSource) Reader() (io.ReadCloser, error) {
-    return gf.file.Open()
+    return eachZipSource(zipReader, ga.basePath, callback)
 }
 
 func (ga *githubAccess) getZipArchive() (zipReader *zip.Reader, err error) {
     var archiveURL *url.URL
     var httpResponse *http.Response
-    var zipBytes []byte
+
+    if ga.zipReader != nil {
+        return ga.zipReader, nil
+    }
 
     err = ga.parseURL()
     if err != nil {
         return nil, err
     }
 
-    archiveURL, _, err = ga.client.Repositories.GetArchiveLink(ga.owner, ga.repos, github.Zipball, nil)
+    // A password of GitHub is a token, so a username is not needed.
+    ga.auth.token, _, err = findToken(ga.tokenFile, tokenEnvName, ga.host)
     if err != nil {
         return nil, err
     }
 
-    httpResponse, err = http.Get(archiveURL.String())
+    archiveURL, err = ga.archiveLink()
     if err != nil {
         return nil, err
     }
 
-    zipBytes, err = ioutil.ReadAll(httpResponse.Body)
+    httpResponse, err = ga.httpClient.Get(archiveURL.String())
     if err != nil {
         return nil, err
     }
+    defer httpResponse.Body.Close()
+    if httpResponse.StatusCode != http.StatusOK {
+        return nil, ga.responseError("Failed to download " + ga.url, httpResponse, nil)
+    }
 
-    zipReader, err = zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+    zipReader, err = ga.spoolZipArchive(httpResponse.Body)
     if err != nil {
         return nil, err
     }
 
+    ga.revision = zipRevision(zipReader)
+    ga.zipReader = zipReader
     return
 }
 
+// spoolZipArchive writes a zipball to a temporary file instead of memory
+// and opens it. The file is removed by Close.
+func (ga *githubAccess) spoolZipArchive(reader io.Reader) (zipReader *zip.Reader, err error) {
+    zipReader, ga.zipFile, ga.archiveHash, err = spoolZip(reader)
+    return
+}
+
+// Close removes a spooled zipball.
+func (ga *githubAccess) Close() error {
+    if ga.zipFile == nil {
+        return nil
+    }
+
+    ga.zipFile.Close()
+    err := os.Remove(ga.zipFile.Name())
+    ga.zipFile = nil
+    ga.zipReader = nil
+    return err
+}
+
+// SourceRevision
+func (ga *githubAccess) Revision() string {
+    return ga.revision
+}
+
+func (ga *githubAccess) ArchiveHash() string {
+    return ga.archiveHash
+}
+
+// setAPIURL sets the configured API URL to the client and returns its host
+// to be accepted as a GitHub Enterprise host.
+func (ga *githubAccess) setAPIURL() (host string, err error) {
+    if ga.apiURL == "" {
+        return "", nil
+    }
+
+    apiURL, err := url.Parse(ga.apiURL)
+    if err != nil {
+        return "", err
+    }
+    if !strings.HasSuffix(apiURL.Path, "/") {
+        apiURL.Path += "/"
+    }
+    ga.client.BaseURL = apiURL
+    ga.auth.host = apiURL.Host
+    return apiURL.Host, nil
+}
+
+// parseURL parses owner/repo[/path][@ref] or owner/repo/(tree|blob)/<ref>/<path>.
+// A ref in the tree form may have slashes, so every split of the ref and
+// the path is kept as a candidate, and the first one is set until
+// getZipArchive resolves it.
 func (ga *githubAccess) parseURL() error {
     url, err := url.Parse(ga.url)
     if err != nil {
         return err
     }
 
-    if url.Host != "github.com" {
+    apiHost, err := ga.setAPIURL()
+    if err != nil {
+        return err
+    }
+    if url.Host != defaultGithubHost && url.Host != apiHost {
         return errors.New("Host is not matched.")
     }
+    ga.host = url.Host
 
-    pathElements := strings.Split(url.Path, "/")
+    urlPath, urlRef := splitURLRef(url.Path)
+    pathElements := strings.Split(strings.TrimSuffix(urlPath, "/"), "/")
     if len(pathElements) < 3 || pathElements[1] == "" || pathElements[2] == "" {
         return errors.New("There is no owner and/or repository in url")
     }
 
     ga.owner = pathElements[1]
     ga.repos = pathElements[2]
+    ga.refCandidates, err = refPathCandidates(ga.url, pathElements[3:], urlRef, ga.ref, "tree", "blob")
+    if err != nil {
+        return err
+    }
+
+    ga.ref = ga.refCandidates[0].ref
+    ga.basePath = ga.refCandidates[0].basePath
+    return nil
+}
 
-    if len(pathElements) < 6 {
-        if len(pathElements) == 3 {
-            ga.basePath = ""
-        } else {
-            ga.basePath = strings.Join(pathElements[3:], "/")
+// archiveLink returns a link to the zipball of the first ref candidate
+// which exists. An empty ref is the default branch.
+func (ga *githubAccess) archiveLink() (*url.URL, error) {
+    var response *github.Response
+    for _, candidate := range ga.refCandidates {
+        var opt *github.RepositoryContentGetOptions
+        if candidate.ref != "" {
+            opt = &github.RepositoryContentGetOptions{Ref: candidate.ref}
         }
-        return nil
+
+        archiveURL, resp, err := ga.client.Repositories.GetArchiveLink(ga.owner, ga.repos, github.Zipball, opt)
+        if err != nil {
+            return nil, err
+        }
+        // GetArchiveLink returns no error when it isn't redirected.
+        if archiveURL != nil {
+            ga.ref = candidate.ref
+            ga.basePath = candidate.basePath
+            return archiveURL, nil
+        }
+        response = resp
     }
 
-    if !((pathElements[3] == "tree" || pathElements[4] == "blob") && pathElements[4] == "master") {
-        return errors.New("No supported url format. Expected format is (tree|blob)/master.")
+    if response == nil || response.Response == nil {
+        return nil, errors.New("No archive link is returned for " + ga.url)
     }
+    return nil, ga.responseError("No archive link is returned for " + ga.url, response.Response, &response.Rate)
+}
 
-    ga.basePath = strings.Join(pathElements[5:], "/")
-    return nil
+// responseError explains why a response is failed.
+func (ga *githubAccess) responseError(message string, resp *http.Response, rate *github.Rate) error {
+    message += ": " + resp.Status
+    tokenHint := "A private repository needs a token by " + tokenEnvName + ", --token-file or a git credential helper."
+    if ga.auth.token != "" {
+        tokenHint = "Check the token can read the repository."
+    }
+
+    switch {
+    case rate != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) && resp.Header.Get("X-RateLimit-Remaining") == "0":
+        message += ". API rate limit exceeded"
+        if !rate.Reset.IsZero() {
+            message += " until " + rate.Reset.Local().Format(time.RFC3339)
+        }
+        if ga.auth.token == "" {
+            message += ". A token by " + tokenEnvName + ", --token-file or a git credential helper raises the limit"
+        }
+        message += "."
+    case resp.StatusCode == http.StatusNotFound:
+        message += ". The repository or the ref is not found. " + tokenHint
+    case resp.StatusCode == http.StatusUnauthorized:
+        message += ". The token is not valid."
+    case resp.StatusCode == http.StatusForbidden:
+        message += ". Access is forbidden. " + tokenHint
+    }
+    return errors.New(message)
 }
@@ -1,6 +1,12 @@
 package main
 
 import (
+    "archive/zip"
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
     "testing"
 )
 
@@ -8,7 +14,7 @@ import (
 const sampleURL = "https://github.com/hata/gorep"
 
 func Test_newGithubAccess(t *testing.T) {
-    ga := newGithubAccess(sampleURL)
+    ga := newGithubAccess(sampleURL, nil)
     if ga.client == nil {
         t.Error("Verify github.Client is initialized.")
     }
@@ -18,7 +24,7 @@ func Test_newGithubAccess(t *testing.T) {
 }
 
 func Test_parseURL(t *testing.T) {
-    ga := newGithubAccess(sampleURL)
+    ga := newGithubAccess(sampleURL, nil)
     err := ga.parseURL()
     if err != nil {
         t.Log(err)
@@ -39,7 +45,7 @@ func Test_parseURL(t *testing.T) {
 }
 
 func Test_parseURL_directory(t *testing.T) {
-    ga := newGithubAccess(sampleURL + "/tree/master/book")
+    ga := newGithubAccess(sampleURL + "/tree/master/book", nil)
     err := ga.parseURL()
     if err != nil {
         t.Log(err)
@@ -60,7 +66,7 @@ func Test_parseURL_directory(t *testing.T) {
 }
 
 func Test_parseURL_wrong_url(t *testing.T) {
-    ga := newGithubAccess("http://www.google.com")
+    ga := newGithubAccess("http://www.google.com", nil)
     err := ga.parseURL()
     if err == nil {
         t.Error("Verify error should be return.")
@@ -68,7 +74,7 @@ func Test_parseURL_wrong_url(t *testing.T) {
 }
 
 func Test_getZipArchive(t *testing.T) {
-    ga := newGithubAccess(sampleURL)
+    ga := newGithubAccess(sampleURL, nil)
     zipReader, err := ga.getZipArchive()
     if err != nil {
         t.Error("There is an error to get archive" + err.Error())
@@ -82,7 +88,7 @@ func Test_getZipArchive(t *testing.T) {
 }
 
 func Test_getZipArchive_checkZipArchive(t *testing.T) {
-    ga := newGithubAccess(sampleURL)
+    ga := newGithubAccess(sampleURL, nil)
     _, err := ga.getZipArchive()
     if err != nil {
         t.Error("There is an error to getarchive 2 " + err.Error())
@@ -91,7 +97,7 @@ func Test_getZipArchive_checkZipArchive(t *testing.T) {
 
 func Test_EachSource(t *testing.T) {
     found := false
-    ga := newGithubAccess(sampleURL)
+    ga := newGithubAccess(sampleURL, nil)
     ga.EachSource(func (fs FileSource) error {
         if fs.SubPath() == ".gitignore" {
             found = true
@@ -106,7 +112,7 @@ func Test_EachSource(t *testing.T) {
 func Test_EachSource_for_directory(t *testing.T) {
     gitIgnoreFound := false
     fileFound := false
-    ga := newGithubAccess(sampleURL + "/book")
+    ga := newGithubAccess(sampleURL + "/book", nil)
     ga.EachSource(func (fs FileSource) error {
         if fs.SubPath() == ".gitignore" {
             gitIgnoreFound = true
@@ -125,3 +131,210 @@ func Test_EachSource_for_directory(t *testing.T) {
     }
 }
 
+
+func newTestZip(t *testing.T, comment string, names ...string) *zip.Reader {
+    return newTestZipContents(t, comment, names, map[string]string{})
+}
+
+// newTestZipContents creates a zip reader of newTestZipArchive.
+func newTestZipContents(t *testing.T, comment string, names []string, contents map[string]string) *zip.Reader {
+    zipBytes := newTestZipArchive(comment, names, contents)
+    zipReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return zipReader
+}
+
+// newTestZipArchive creates a zip. A name with a trailing slash is
+// a directory, and a file has its name as contents unless contents are given.
+func newTestZipArchive(comment string, names []string, contents map[string]string) []byte {
+    buf := new(bytes.Buffer)
+    w := zip.NewWriter(buf)
+    for _, name := range names {
+        f, _ := w.Create(name)
+        if c, ok := contents[name]; ok {
+            f.Write([]byte(c))
+        } else if !strings.HasSuffix(name, "/") {
+            f.Write([]byte(name))
+        }
+    }
+    w.SetComment(comment)
+    w.Close()
+    return buf.Bytes()
+}
+
+func Test_zipRevision_comment(t *testing.T) {
+    zipReader := newTestZip(t, "0123456789abcdef", "hata-gorep-0123456/", "hata-gorep-0123456/README.md")
+    if zipRevision(zipReader) != "0123456789abcdef" {
+        t.Error("Verify a commit in a comment is returned")
+    }
+}
+
+func Test_zipRevision_topDirectory(t *testing.T) {
+    zipReader := newTestZip(t, "", "hata-gorep-0123456/", "hata-gorep-0123456/README.md")
+    if zipRevision(zipReader) != "0123456" {
+        t.Error("Verify a commit in a top directory is returned")
+    }
+}
+
+func Test_EachSource_ignore(t *testing.T) {
+    ga := newGithubAccess(sampleURL, nil)
+    ga.zipReader = newTestZipContents(t, "", []string{"hata-gorep-0123456/", "hata-gorep-0123456/" + ignoreFileName,
+        "hata-gorep-0123456/docs/", "hata-gorep-0123456/docs/a.md", "hata-gorep-0123456/main.go"},
+        map[string]string{"hata-gorep-0123456/" + ignoreFileName: "docs/\n"})
+
+    var found []string
+    ga.EachSource(func (fs FileSource) error {
+        found = append(found, fs.SubPath())
+        return nil
+    })
+
+    if len(found) != 2 || found[0] != "" || found[1] != "main.go" {
+        t.Error("Verify ignored files are not walked", found)
+    }
+}
+
+func Test_spoolZipArchive(t *testing.T) {
+    buf := new(bytes.Buffer)
+    w := zip.NewWriter(buf)
+    f, _ := w.Create("hata-gorep-0123456/README.md")
+    f.Write([]byte("readme"))
+    w.Close()
+    expectedHash := checksum(buf.Bytes())
+
+    ga := newGithubAccess(sampleURL, nil)
+    zipReader, err := ga.spoolZipArchive(buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(zipReader.File) != 1 {
+        t.Error("Verify a spooled zip is read.", zipReader.File)
+    }
+    assertString(t, "Verify an archive hash", expectedHash, ga.ArchiveHash())
+
+    spooledPath := ga.zipFile.Name()
+    if err = ga.Close(); err != nil {
+        t.Error("Verify Close works.", err)
+    }
+    if _, err = os.Stat(spooledPath); !os.IsNotExist(err) {
+        t.Error("Verify a spooled file is removed.", err)
+    }
+}
+
+// newTestGithubServer serves an archive link API and a zipball like GitHub.
+// apiPrefix is the path of the API like "/api/v3" for GitHub Enterprise.
+// Only refs and the default branch have zipballs.
+func newTestGithubServer(t *testing.T, apiPrefix string, zipBytes []byte, refs ...string) *httptest.Server {
+    mux := http.NewServeMux()
+    server := httptest.NewServer(mux)
+    archivePath := apiPrefix + "/repos/hata/gorep/zipball"
+    mux.HandleFunc(archivePath + "/", func(w http.ResponseWriter, r *http.Request) {
+        ref := strings.TrimPrefix(r.URL.Path, archivePath)
+        for _, known := range append(refs, "") {
+            if ref == "/" + known {
+                http.Redirect(w, r, server.URL + "/archive/hata-gorep-0123456.zip", http.StatusFound)
+                return
+            }
+        }
+        http.NotFound(w, r)
+    })
+    mux.HandleFunc(archivePath, func(w http.ResponseWriter, r *http.Request) {
+        http.Redirect(w, r, server.URL + "/archive/hata-gorep-0123456.zip", http.StatusFound)
+    })
+    mux.HandleFunc("/archive/hata-gorep-0123456.zip", func(w http.ResponseWriter, r *http.Request) {
+        w.Write(zipBytes)
+    })
+    return server
+}
+
+func newTestZipBytes(names ...string) []byte {
+    return newTestZipArchive("", names, nil)
+}
+
+func Test_getZipArchive_server(t *testing.T) {
+    zipBytes := newTestZipBytes("hata-gorep-0123456/", "hata-gorep-0123456/book/", "hata-gorep-0123456/book/README.md")
+    server := newTestGithubServer(t, "", zipBytes, "master")
+    defer server.Close()
+
+    ga := newGithubAccess(sampleURL + "/tree/master/book", &sourceConfig{githubAPIURL: server.URL, httpClient: server.Client()})
+    defer ga.Close()
+    assertString(t, "Verify files are read from a server", ",README.md", collectSubPaths(t, ga))
+    assertString(t, "Verify a revision", "0123456", ga.Revision())
+    assertString(t, "Verify an archive hash", checksum(zipBytes), ga.ArchiveHash())
+}
+
+func Test_getZipArchive_enterprise(t *testing.T) {
+    server := newTestGithubServer(t, "/api/v3", newTestZipBytes("hata-gorep-0123456/", "hata-gorep-0123456/README.md"))
+    defer server.Close()
+
+    ga := newGithubAccess(server.URL + "/hata/gorep", &sourceConfig{githubAPIURL: server.URL + "/api/v3", httpClient: server.Client()})
+    defer ga.Close()
+    assertString(t, "Verify files are read from an enterprise host", ",README.md", collectSubPaths(t, ga))
+}
+
+func Test_getZipArchive_notRedirected(t *testing.T) {
+    server := httptest.NewServer(http.NotFoundHandler())
+    defer server.Close()
+
+    ga := newGithubAccess(sampleURL, &sourceConfig{githubAPIURL: server.URL, httpClient: server.Client()})
+    if _, err := ga.getZipArchive(); err == nil {
+        t.Error("Verify an error is returned without an archive link.")
+    }
+}
+
+func Test_parseURL_unknownHost(t *testing.T) {
+    ga := newGithubAccess("https://github.example.com/hata/gorep", nil)
+    if ga.parseURL() == nil {
+        t.Error("Verify an unknown host is an error.")
+    }
+
+    ga = newGithubAccess("https://github.example.com/hata/gorep", &sourceConfig{githubAPIURL: "https://github.example.com/api/v3"})
+    if err := ga.parseURL(); err != nil {
+        t.Error("Verify a host of the API URL is accepted.", err)
+    }
+    assertString(t, "Verify the API URL", "https://github.example.com/api/v3/", ga.client.BaseURL.String())
+}
+
+func Test_parseURL_ref(t *testing.T) {
+    ga := newGithubAccess(sampleURL + "/book@v2.3.0", nil)
+    if err := ga.parseURL(); err != nil {
+        t.Fatal(err)
+    }
+    assertString(t, "Verify a ref of @ref", "v2.3.0", ga.ref)
+    assertString(t, "Verify a path with @ref", "book", ga.basePath)
+
+    ga = newGithubAccess(sampleURL + "/book@v2.3.0", &sourceConfig{ref: "main"})
+    ga.parseURL()
+    assertString(t, "Verify --ref takes precedence", "main", ga.ref)
+
+    ga = newGithubAccess(sampleURL + "/tree/feature/x/book", &sourceConfig{ref: "feature/x"})
+    ga.parseURL()
+    assertString(t, "Verify --ref selects a split of a tree URL", "book", ga.basePath)
+
+    ga = newGithubAccess(sampleURL + "/tree/main@v1", nil)
+    if ga.parseURL() == nil {
+        t.Error("Verify two refs are an error.")
+    }
+}
+
+func Test_getZipArchive_slashRef(t *testing.T) {
+    zipBytes := newTestZipBytes("hata-gorep-0123456/", "hata-gorep-0123456/book/", "hata-gorep-0123456/book/README.md")
+    server := newTestGithubServer(t, "", zipBytes, "feature/x")
+    defer server.Close()
+
+    ga := newGithubAccess(sampleURL + "/tree/feature/x/book", &sourceConfig{githubAPIURL: server.URL, httpClient: server.Client()})
+    defer ga.Close()
+    assertString(t, "Verify files under a path are read", ",README.md", collectSubPaths(t, ga))
+    assertString(t, "Verify a ref with a slash is resolved", "feature/x", ga.ref)
+}
+
+func Test_getZipArchive_unknownRef(t *testing.T) {
+    server := newTestGithubServer(t, "", newTestZipBytes("hata-gorep-0123456/"), "main")
+    defer server.Close()
+
+    ga := newGithubAccess(sampleURL + "@v9", &sourceConfig{githubAPIURL: server.URL, httpClient: server.Client()})
+    if _, err := ga.getZipArchive(); err == nil {
+        t.Error("Verify an unknown ref is an error.")
+    }
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+    "archive/zip"
+    "errors"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+)
+
+// Hosts of template URLs which are read by hosting services without
+// --source-type.
+const (
+    defaultGitlabHost = "gitlab.com"
+    defaultBitbucketHost = "bitbucket.org"
+)
+
+// archiveService knows URLs of a hosting service which serves zip archives
+// of repositories. A base URL is taken from a template URL, so that
+// a self-hosted service works as well.
+type archiveService interface {
+    // parse parses a template URL and returns ref candidates. ref is given
+    // by --ref and takes precedence over a ref in the URL.
+    parse(srcURL *url.URL, ref string) ([]sourceRef, error)
+    // archiveURL returns a URL of a zip archive of a ref. An empty ref is
+    // the default branch.
+    archiveURL(ref string) string
+    // tokenEnvName returns an environment variable of a token.
+    tokenEnvName() string
+    // authHeader returns a header and a prefix of a token.
+    authHeader() (header string, prefix string)
+    // basicAuth returns true when a username and a password of a git
+    // credential helper are sent by Basic auth instead of authHeader.
+    basicAuth() bool
+}
+
+// hostedAccess reads a template from a zip archive of a hosting service
+// other than GitHub.
+type hostedAccess struct {
+    service archiveService
+    httpClient *http.Client
+    auth *tokenTransport
+    tokenFile string
+    url string
+    basePath string
+    // ref is a branch, a tag or a commit. An empty ref is the default branch.
+    ref string
+    revision string
+    archiveHash string
+    zipReader *zip.Reader
+    zipFile *os.File
+}
+
+// sourceRef is a pair of a ref and a base path split from a URL.
+type sourceRef struct {
+    ref string
+    basePath string
+}
+
+// gitlabService accepts <namespace>/<project>[@ref] and
+// <namespace>/<project>/-/(tree|blob)/<ref>/<path>.
+type gitlabService struct {
+    baseURL string
+    project string
+}
+
+// bitbucketService accepts <workspace>/<repo>[/path][@ref] and
+// <workspace>/<repo>/src/<ref>/<path> of Bitbucket Cloud, and
+// projects/<key>/repos/<repo>/browse/<path>?at=<ref>, users/<user>/repos/<repo>
+// and scm/<key>/<repo>.git of Bitbucket Server and Data Center.
+type bitbucketService struct {
+    baseURL string
+    workspace string
+    repo string
+    // project is projects/<key> of Bitbucket Server. It is empty for
+    // Bitbucket Cloud.
+    project string
+}
+
+// bitbucketServerPrefix is a top directory of an archive of Bitbucket
+// Server, which has no top directory by default.
+const bitbucketServerPrefix = "archive/"
+
+func newHostedAccess(srcURL string, service archiveService, config *sourceConfig) (ha *hostedAccess) {
+    if config == nil {
+        config = new(sourceConfig)
+    }
+
+    ha = new(hostedAccess)
+    ha.service = service
+    header, prefix := service.authHeader()
+    ha.httpClient, ha.auth = newTokenClient(config.httpClient, header, prefix)
+    ha.tokenFile = config.tokenFile
+    ha.ref = config.ref
+    ha.url = srcURL
+    return
+}
+
+// hostedSourceType returns a source type of a hosting service by a host
+// of src. An empty string is returned for other hosts.
+func hostedSourceType(src string) string {
+    srcURL, err := url.Parse(src)
+    if err != nil {
+        return ""
+    }
+
+    switch srcURL.Host {
+    case defaultGitlabHost:
+        return SourceGitlab
+    case defaultBitbucketHost:
+        return SourceBitbucket
+    }
+    return ""
+}
+
+// SourceAccess
+func (ha *hostedAccess) EachSource(callback FileSourceFunc) error {
+    zipReader, err := ha.getZipArchive()
+    if err != nil {
+        return err
+    }
+
+    return eachZipSource(zipReader, ha.basePath, callback)
+}
+
+func (ha *hostedAccess) getZipArchive() (zipReader *zip.Reader, err error) {
+    if ha.zipReader != nil {
+        return ha.zipReader, nil
+    }
+
+    srcURL, err := url.Parse(ha.url)
+    if err != nil {
+        return nil, err
+    }
+    candidates, err := ha.service.parse(srcURL, ha.ref)
+    if err != nil {
+        return nil, err
+    }
+
+    ha.auth.host = srcURL.Host
+    var username string
+    ha.auth.token, username, err = findToken(ha.tokenFile, ha.service.tokenEnvName(), srcURL.Host)
+    if err != nil {
+        return nil, err
+    }
+    if ha.service.basicAuth() {
+        ha.auth.username = username
+    }
+
+    for i, candidate := range candidates {
+        // A ref with slashes may be split at a wrong place, so the next
+        // candidate is tried when an archive is not found.
+        last := i == len(candidates) - 1
+        zipReader, err = ha.download(candidate, last)
+        if err != nil || zipReader != nil {
+            break
+        }
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    ha.revision = zipRevision(zipReader)
+    ha.zipReader = zipReader
+    return
+}
+
+// download spools an archive of a ref candidate. nil is returned without an
+// error when the archive is not found and it isn't the last candidate.
+func (ha *hostedAccess) download(candidate sourceRef, last bool) (zipReader *zip.Reader, err error) {
+    httpResponse, err := ha.httpClient.Get(ha.service.archiveURL(candidate.ref))
+    if err != nil {
+        return nil, err
+    }
+    defer httpResponse.Body.Close()
+
+    if httpResponse.StatusCode == http.StatusNotFound && !last {
+        return nil, nil
+    }
+    if httpResponse.StatusCode != http.StatusOK {
+        return nil, ha.responseError("Failed to download " + ha.url, httpResponse)
+    }
+
+    zipReader, ha.zipFile, ha.archiveHash, err = spoolZip(httpResponse.Body)
+    if err != nil {
+        return nil, err
+    }
+    ha.ref = candidate.ref
+    ha.basePath = candidate.basePath
+    return zipReader, nil
+}
+
+// responseError explains why a response is failed.
+func (ha *hostedAccess) responseError(message string, resp *http.Response) error {
+    message += ": " + resp.Status
+    tokenHint := "A private repository needs a token by " + ha.service.tokenEnvName() + ", --token-file or a git credential helper."
+    if ha.auth.token != "" {
+        tokenHint = "Check the token can read the repository."
+    }
+
+    switch resp.StatusCode {
+    case http.StatusNotFound:
+        message += ". The repository or the ref is not found. " + tokenHint
+    case http.StatusUnauthorized:
+        message += ". The token is not valid."
+    case http.StatusForbidden:
+        message += ". Access is forbidden. " + tokenHint
+    case http.StatusTooManyRequests:
+        message += ". Rate limit exceeded."
+        if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+            message += " Retry after " + retryAfter + " seconds."
+        }
+    }
+    return errors.New(message)
+}
+
+// Close removes a spooled archive.
+func (ha *hostedAccess) Close() error {
+    if ha.zipFile == nil {
+        return nil
+    }
+
+    ha.zipFile.Close()
+    err := os.Remove(ha.zipFile.Name())
+    ha.zipFile = nil
+    ha.zipReader = nil
+    return err
+}
+
+// SourceRevision
+func (ha *hostedAccess) Revision() string {
+    return ha.revision
+}
+
+func (ha *hostedAccess) ArchiveHash() string {
+    return ha.archiveHash
+}
+
+// archiveService
+func (gs *gitlabService) parse(srcURL *url.URL, ref string) ([]sourceRef, error) {
+    urlPath, urlRef := splitURLRef(srcURL.Path)
+
+    // A project may be in nested groups, so a path in a project is given
+    // only after "/-/".
+    project, rest := urlPath, ""
+    if index := strings.Index(urlPath, "/-/"); index != -1 {
+        project, rest = urlPath[:index], urlPath[index + len("/-/"):]
+    }
+    project = strings.TrimSuffix(strings.Trim(project, "/"), ".git")
+    if !strings.Contains(project, "/") {
+        return nil, errors.New("There is no namespace and/or project in url")
+    }
+
+    var elements []string
+    if rest = strings.Trim(rest, "/"); rest != "" {
+        elements = strings.Split(rest, "/")
+        if elements[0] != "tree" && elements[0] != "blob" {
+            return nil, errors.New("Unknown page of a project in url: " + srcURL.String())
+        }
+    }
+
+    gs.baseURL = srcURL.Scheme + "://" + srcURL.Host
+    gs.project = project
+    return refPathCandidates(srcURL.String(), elements, urlRef, ref, "tree", "blob")
+}
+
+func (gs *gitlabService) archiveURL(ref string) string {
+    archiveURL := gs.baseURL + "/api/v4/projects/" + url.PathEscape(gs.project) + "/repository/archive.zip"
+    if ref != "" {
+        archiveURL += "?sha=" + url.QueryEscape(ref)
+    }
+    return archiveURL
+}
+
+func (gs *gitlabService) tokenEnvName() string {
+    return gitlabTokenEnvName
+}
+
+func (gs *gitlabService) authHeader() (string, string) {
+    return "PRIVATE-TOKEN", ""
+}
+
+// basicAuth returns false because GitLab API doesn't accept Basic auth and
+// a password of a git credential helper is a personal access token.
+func (gs *gitlabService) basicAuth() bool {
+    return false
+}
+
+// archiveService
+func (bs *bitbucketService) parse(srcURL *url.URL, ref string) ([]sourceRef, error) {
+    urlPath, urlRef := splitURLRef(srcURL.Path)
+    pathElements := strings.Split(strings.Trim(urlPath, "/"), "/")
+    if index := bitbucketServerIndex(pathElements); index != -1 && srcURL.Host != defaultBitbucketHost {
+        return bs.parseServer(srcURL, pathElements, index, urlRef, ref)
+    }
+    if len(pathElements) < 2 || pathElements[0] == "" || pathElements[1] == "" {
+        return nil, errors.New("There is no workspace and/or repository in url")
+    }
+
+    bs.baseURL = srcURL.Scheme + "://" + srcURL.Host
+    bs.workspace = pathElements[0]
+    bs.repo = strings.TrimSuffix(pathElements[1], ".git")
+    return refPathCandidates(srcURL.String(), pathElements[2:], urlRef, ref, "src")
+}
+
+// parseServer parses a URL of Bitbucket Server whose repository starts
+// from pathElements[index]. A path before it is a context path.
+func (bs *bitbucketService) parseServer(srcURL *url.URL, pathElements []string, index int, urlRef string, ref string) ([]sourceRef, error) {
+    bs.baseURL = srcURL.Scheme + "://" + srcURL.Host
+    if index > 0 {
+        bs.baseURL += "/" + strings.Join(pathElements[:index], "/")
+    }
+
+    var rest []string
+    switch pathElements[index] {
+    case "scm":
+        bs.project = "projects/" + pathElements[index + 1]
+        bs.repo = strings.TrimSuffix(pathElements[index + 2], ".git")
+        rest = pathElements[index + 3:]
+    case "users":
+        // A personal repository is a project of ~<user> in REST API.
+        bs.project = "projects/~" + pathElements[index + 1]
+        bs.repo = pathElements[index + 3]
+        rest = pathElements[index + 4:]
+    default:
+        bs.project = "projects/" + pathElements[index + 1]
+        bs.repo = pathElements[index + 3]
+        rest = pathElements[index + 4:]
+    }
+
+    if len(rest) > 0 {
+        if rest[0] != "browse" {
+            return nil, errors.New("Unknown page of a repository in url: " + srcURL.String())
+        }
+        rest = rest[1:]
+    }
+    if at := srcURL.Query().Get("at"); at != "" {
+        urlRef = at
+    }
+    return refPathCandidates(srcURL.String(), rest, urlRef, ref)
+}
+
+// bitbucketServerIndex returns an index of projects/<key>/repos/<repo>,
+// users/<user>/repos/<repo> or scm/<key>/<repo> in pathElements, or -1 when
+// a URL is not of Bitbucket Server.
+func bitbucketServerIndex(pathElements []string) int {
+    for i, element := range pathElements {
+        switch {
+        case (element == "projects" || element == "users") && i + 3 < len(pathElements) && pathElements[i + 2] == "repos":
+            return i
+        case element == "scm" && i + 2 < len(pathElements) && strings.HasSuffix(pathElements[i + 2], ".git"):
+            return i
+        }
+    }
+    return -1
+}
+
+func (bs *bitbucketService) archiveURL(ref string) string {
+    if bs.project != "" {
+        archiveURL := bs.baseURL + "/rest/api/latest/" + bs.project + "/repos/" + bs.repo + "/archive?format=zip&prefix=" + bitbucketServerPrefix
+        if ref != "" {
+            archiveURL += "&at=" + url.QueryEscape(ref)
+        }
+        return archiveURL
+    }
+    if ref == "" {
+        ref = "HEAD"
+    }
+    return bs.baseURL + "/" + bs.workspace + "/" + bs.repo + "/get/" + ref + ".zip"
+}
+
+func (bs *bitbucketService) tokenEnvName() string {
+    return bitbucketTokenEnvName
+}
+
+func (bs *bitbucketService) authHeader() (string, string) {
+    return "Authorization", "Bearer "
+}
+
+// basicAuth returns true because a git credential helper keeps a username
+// and an app password(or a password of Bitbucket Server), which are not
+// a bearer token.
+func (bs *bitbucketService) basicAuth() bool {
+    return true
+}
+
+// splitURLRef splits a URL path into a path and a ref after "@".
+func splitURLRef(urlPath string) (string, string) {
+    if index := strings.Index(urlPath, "@"); index != -1 {
+        return urlPath[:index], urlPath[index + 1:]
+    }
+    return urlPath, ""
+}
+
+// refPathCandidates returns ref candidates of path elements after
+// a repository like <kind>/<ref>/<path> or <path>. A ref in the kind form
+// may have slashes, so every split of the ref and the path is a candidate.
+// urlRef is given by @<ref> in a URL and ref is given by --ref.
+func refPathCandidates(srcURL string, elements []string, urlRef string, ref string, kinds ...string) ([]sourceRef, error) {
+    isKind := false
+    for _, kind := range kinds {
+        isKind = isKind || (len(elements) >= 2 && elements[0] == kind)
+    }
+
+    if !isKind {
+        if ref == "" {
+            ref = urlRef
+        }
+        return []sourceRef{{ref: ref, basePath: strings.Join(elements, "/")}}, nil
+    }
+
+    if urlRef != "" {
+        return nil, errors.New("A ref is given by both " + elements[0] + "/<ref> and @<ref>.")
+    }
+    var candidates []sourceRef
+    for i := 2; i <= len(elements); i++ {
+        candidate := sourceRef{ref: strings.Join(elements[1:i], "/"), basePath: strings.Join(elements[i:], "/")}
+        if ref == "" || ref == candidate.ref {
+            candidates = append(candidates, candidate)
+        }
+    }
+    if len(candidates) == 0 {
+        return nil, errors.New("A ref " + ref + " is not matched with url " + srcURL)
+    }
+    return candidates, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func Test_gitlabService_parse(t *testing.T) {
+    gs := new(gitlabService)
+    srcURL, _ := url.Parse("https://gitlab.example.com/group/sub/project/-/tree/feature/x/book")
+    candidates, err := gs.parse(srcURL, "")
+    if err != nil || len(candidates) != 3 {
+        t.Fatal("Verify every split of a tree URL is a candidate.", candidates, err)
+    }
+    assertString(t, "Verify a project in nested groups", "group/sub/project", gs.project)
+    assertString(t, "Verify the first candidate", "feature", candidates[0].ref)
+    assertString(t, "Verify a base path of the second candidate", "book", candidates[1].basePath)
+    assertString(t, "Verify an archive URL of a self-hosted service",
+        "https://gitlab.example.com/api/v4/projects/group%2Fsub%2Fproject/repository/archive.zip?sha=feature%2Fx",
+        gs.archiveURL(candidates[1].ref))
+
+    srcURL, _ = url.Parse("https://gitlab.com/group/project.git@v1")
+    candidates, err = gs.parse(srcURL, "")
+    if err != nil || len(candidates) != 1 || candidates[0].ref != "v1" {
+        t.Error("Verify a ref after @.", candidates, err)
+    }
+    assertString(t, "Verify .git is removed", "group/project", gs.project)
+
+    srcURL, _ = url.Parse("https://gitlab.com/project")
+    if _, err = gs.parse(srcURL, ""); err == nil {
+        t.Error("Verify a URL without a namespace is an error.")
+    }
+}
+
+func Test_bitbucketService_parse(t *testing.T) {
+    bs := new(bitbucketService)
+    srcURL, _ := url.Parse("https://bitbucket.org/hata/gorep/src/v1/book")
+    candidates, err := bs.parse(srcURL, "")
+    if err != nil || len(candidates) != 2 {
+        t.Fatal("Verify a src URL is parsed.", candidates, err)
+    }
+    assertString(t, "Verify a base path", "book", candidates[0].basePath)
+    assertString(t, "Verify an archive URL", "https://bitbucket.org/hata/gorep/get/v1.zip", bs.archiveURL(candidates[0].ref))
+    assertString(t, "Verify an archive URL of the default branch", "https://bitbucket.org/hata/gorep/get/HEAD.zip", bs.archiveURL(""))
+
+    srcURL, _ = url.Parse("https://bitbucket.org/hata/gorep/src/v1/book")
+    if _, err = bs.parse(srcURL, "v2"); err == nil {
+        t.Error("Verify --ref which is not matched with a URL is an error.")
+    }
+}
+
+func Test_bitbucketService_parseServer(t *testing.T) {
+    bs := new(bitbucketService)
+    srcURL, _ := url.Parse("https://git.example.com/bitbucket/projects/PRJ/repos/gorep/browse/book?at=refs%2Fheads%2Fmain")
+    candidates, err := bs.parse(srcURL, "")
+    if err != nil || len(candidates) != 1 {
+        t.Fatal("Verify a browse URL is parsed.", candidates, err)
+    }
+    assertString(t, "Verify a base path", "book", candidates[0].basePath)
+    assertString(t, "Verify an archive URL with a context path",
+        "https://git.example.com/bitbucket/rest/api/latest/projects/PRJ/repos/gorep/archive?format=zip&prefix=archive/&at=refs%2Fheads%2Fmain",
+        bs.archiveURL(candidates[0].ref))
+
+    srcURL, _ = url.Parse("https://git.example.com/users/hata/repos/gorep")
+    candidates, err = bs.parse(srcURL, "v1")
+    if err != nil || len(candidates) != 1 {
+        t.Fatal("Verify a personal repository is parsed.", candidates, err)
+    }
+    assertString(t, "Verify an archive URL of a personal repository",
+        "https://git.example.com/rest/api/latest/projects/~hata/repos/gorep/archive?format=zip&prefix=archive/&at=v1",
+        bs.archiveURL(candidates[0].ref))
+
+    srcURL, _ = url.Parse("https://git.example.com/scm/PRJ/gorep.git")
+    if _, err = bs.parse(srcURL, ""); err != nil {
+        t.Fatal("Verify a clone URL is parsed.", err)
+    }
+    assertString(t, "Verify an archive URL of the default branch",
+        "https://git.example.com/rest/api/latest/projects/PRJ/repos/gorep/archive?format=zip&prefix=archive/",
+        bs.archiveURL(""))
+
+    srcURL, _ = url.Parse("https://git.example.com/projects/PRJ/repos/gorep/commits")
+    if _, err = bs.parse(srcURL, ""); err == nil {
+        t.Error("Verify an unknown page is an error.")
+    }
+}
+
+func Test_hostedAccess_gitlab(t *testing.T) {
+    defer setTestEnv(t, gitlabTokenEnvName, "secret")()
+
+    zipBytes := newTestZipBytes("project-feature-x-0123456/", "project-feature-x-0123456/book/", "project-feature-x-0123456/book/README.md")
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.EscapedPath() != "/api/v4/projects/group%2Fproject/repository/archive.zip" ||
+            r.URL.Query().Get("sha") != "feature/x" || r.Header.Get("PRIVATE-TOKEN") != "secret" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Write(zipBytes)
+    }))
+    defer server.Close()
+
+    ha := newHostedAccess(server.URL + "/group/project/-/tree/feature/x/book", new(gitlabService), &sourceConfig{httpClient: server.Client()})
+    defer ha.Close()
+    assertString(t, "Verify files under a path of a ref with a slash", ",README.md", collectSubPaths(t, ha))
+    assertString(t, "Verify a ref is resolved", "feature/x", ha.ref)
+    assertString(t, "Verify a revision", "0123456", ha.Revision())
+}
+
+func Test_hostedAccess_bitbucket(t *testing.T) {
+    defer setTestEnv(t, bitbucketTokenEnvName, "secret")()
+
+    zipBytes := newTestZipBytes("hata-gorep-0123456/", "hata-gorep-0123456/README.md")
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/hata/gorep/get/v1.zip" || r.Header.Get("Authorization") != "Bearer secret" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Write(zipBytes)
+    }))
+    defer server.Close()
+
+    ha := newHostedAccess(server.URL + "/hata/gorep", new(bitbucketService), &sourceConfig{ref: "v1", httpClient: server.Client()})
+    defer ha.Close()
+    assertString(t, "Verify files of a ref", ",README.md", collectSubPaths(t, ha))
+}
+
+func Test_hostedAccess_bitbucketHelper(t *testing.T) {
+    defer setTestEnv(t, bitbucketTokenEnvName, "")()
+    homeDir, _ := ioutil.TempDir("", "gokeleton-home")
+    defer os.RemoveAll(homeDir)
+    ioutil.WriteFile(filepath.Join(homeDir, ".gitconfig"), []byte("[credential]\n\thelper = \"!f() { echo username=hata; echo password=app-password; }; f\"\n"), 0600)
+    defer setTestEnv(t, "HOME", homeDir)()
+    defer setTestEnv(t, "GIT_CONFIG_NOSYSTEM", "1")()
+
+    zipBytes := newTestZipBytes("hata-gorep-0123456/", "hata-gorep-0123456/README.md")
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if username, password, ok := r.BasicAuth(); !ok || username != "hata" || password != "app-password" {
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        w.Write(zipBytes)
+    }))
+    defer server.Close()
+
+    ha := newHostedAccess(server.URL + "/hata/gorep", new(bitbucketService), &sourceConfig{httpClient: server.Client()})
+    defer ha.Close()
+    assertString(t, "Verify a credential of a helper is sent by Basic auth", ",README.md", collectSubPaths(t, ha))
+}
+
+func Test_hostedAccess_bitbucketServer(t *testing.T) {
+    defer setTestEnv(t, bitbucketTokenEnvName, "secret")()
+
+    zipBytes := newTestZipBytes("archive/", "archive/book/", "archive/book/README.md")
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/rest/api/latest/projects/PRJ/repos/gorep/archive" || r.URL.Query().Get("at") != "v1" ||
+            r.URL.Query().Get("format") != "zip" || r.Header.Get("Authorization") != "Bearer secret" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Write(zipBytes)
+    }))
+    defer server.Close()
+
+    ha := newHostedAccess(server.URL + "/projects/PRJ/repos/gorep/browse/book?at=v1", new(bitbucketService), &sourceConfig{httpClient: server.Client()})
+    defer ha.Close()
+    assertString(t, "Verify files under a path of Bitbucket Server", ",README.md", collectSubPaths(t, ha))
+}
+
+func Test_hostedAccess_errors(t *testing.T) {
+    defer setTestEnv(t, gitlabTokenEnvName, "")()
+    defer setTestEnv(t, "GIT_CONFIG_NOSYSTEM", "1")()
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.NotFound(w, r)
+    }))
+    defer server.Close()
+
+    ha := newHostedAccess(server.URL + "/group/project", new(gitlabService), &sourceConfig{httpClient: server.Client()})
+    _, err := ha.getZipArchive()
+    if err == nil || !strings.Contains(err.Error(), "not found") || !strings.Contains(err.Error(), gitlabTokenEnvName) {
+        t.Error("Verify a missing repository explains a token.", err)
+    }
+}
+
+func Test_detectSourceType(t *testing.T) {
+    assertString(t, "Verify gitlab.com", SourceGitlab, detectSourceType("https://gitlab.com/group/project", nil))
+    assertString(t, "Verify bitbucket.org", SourceBitbucket, detectSourceType("https://bitbucket.org/hata/gorep", nil))
+    assertString(t, "Verify an unknown host is read by git", SourceGit, detectSourceType("https://gitlab.example.com/group/project", nil))
+    assertString(t, "Verify --source-type", SourceGitlab,
+        detectSourceType("https://gitlab.example.com/group/project", &sourceConfig{sourceType: SourceGitlab}))
+
+    if _, ok := newSourceAccess("https://bitbucket.org/hata/gorep", nil).(*hostedAccess); !ok {
+        t.Error("Verify a Bitbucket URL is read from an archive.")
+    }
+    if checkSourceType("svn") == nil {
+        t.Error("Verify an unknown source type is an error.")
+    }
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+    "io/ioutil"
+    "path"
+    "strings"
+)
+
+// ignoreFileName is a file in a template root which lists files not to be
+// generated with gitignore semantics. The file itself is not generated.
+const ignoreFileName = ".gokeletonignore"
+
+type ignoreRules struct {
+    rules []*ignoreRule
+}
+
+type ignoreRule struct {
+    negate bool
+    dirOnly bool
+    anchored bool
+    glob []string
+}
+
+// parseIgnore parses lines of an ignore file.
+func parseIgnore(contents string) *ignoreRules {
+    rules := new(ignoreRules)
+
+    for _, line := range strings.Split(contents, "\n") {
+        line = strings.TrimRight(line, "\r")
+        if !strings.HasSuffix(line, "\\ ") {
+            line = strings.TrimRight(line, " ")
+        }
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        rule := new(ignoreRule)
+        if strings.HasPrefix(line, "!") {
+            rule.negate = true
+            line = line[1:]
+        } else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+            line = line[1:]
+        }
+
+        if strings.HasSuffix(line, "/") {
+            rule.dirOnly = true
+            line = strings.TrimRight(line, "/")
+        }
+        if strings.Contains(line, "/") {
+            rule.anchored = true
+            line = strings.TrimPrefix(line, "/")
+        }
+        if line == "" {
+            continue
+        }
+
+        rule.glob = strings.Split(line, "/")
+        rules.rules = append(rules.rules, rule)
+    }
+
+    return rules
+}
+
+// readIgnore parses an ignore file. No rules are returned for an error.
+func readIgnore(fileSource FileSource) *ignoreRules {
+    reader, err := fileSource.Reader()
+    if err != nil {
+        return new(ignoreRules)
+    }
+    defer reader.Close()
+
+    contents, err := ioutil.ReadAll(reader)
+    if err != nil {
+        return new(ignoreRules)
+    }
+    return parseIgnore(string(contents))
+}
+
+// isIgnored returns true when a sub path or one of its parent directories
+// is ignored.
+func (rules *ignoreRules) isIgnored(subPath string, isDir bool) bool {
+    subPath = toSlashSubPath(subPath)
+    if subPath == "" {
+        return false
+    }
+    if subPath == ignoreFileName {
+        return true
+    }
+
+    elems := strings.Split(subPath, "/")
+    for i := 1; i < len(elems); i++ {
+        if rules.match(elems[:i], true) {
+            return true
+        }
+    }
+    return rules.match(elems, isDir)
+}
+
+// match applies rules to a path. The last matched rule decides it.
+func (rules *ignoreRules) match(elems []string, isDir bool) bool {
+    ignored := false
+    for _, rule := range rules.rules {
+        if rule.dirOnly && !isDir {
+            continue
+        }
+        if rule.match(elems) {
+            ignored = !rule.negate
+        }
+    }
+    return ignored
+}
+
+func (rule *ignoreRule) match(elems []string) bool {
+    if !rule.anchored {
+        ok, _ := path.Match(rule.glob[0], elems[len(elems) - 1])
+        return ok
+    }
+    return matchGlob(rule.glob, elems)
+}
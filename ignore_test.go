@@ -0,0 +1,58 @@
+package main
+
+import (
+    "os"
+    "testing"
+)
+
+func assertIgnored(t *testing.T, rules *ignoreRules, subPath string, isDir bool, expected bool) {
+    if rules.isIgnored(subPath, isDir) != expected {
+        t.Errorf("Verify %s is ignored: %v", subPath, expected)
+    }
+}
+
+func Test_parseIgnore(t *testing.T) {
+    rules := parseIgnore("# comment\n\n*.log\n!keep.log\n/TEMPLATE.md\nbuild/\ndocs/internal\n**/cache/**\n\\#hash\n")
+
+    assertIgnored(t, rules, "a.log", false, true)
+    assertIgnored(t, rules, "sub/a.log", false, true)
+    assertIgnored(t, rules, "keep.log", false, false)
+    assertIgnored(t, rules, "TEMPLATE.md", false, true)
+    assertIgnored(t, rules, "sub/TEMPLATE.md", false, false)
+    assertIgnored(t, rules, "build", true, true)
+    assertIgnored(t, rules, "build", false, false)
+    assertIgnored(t, rules, "sub/build/a.go", false, true)
+    assertIgnored(t, rules, "docs/internal", true, true)
+    assertIgnored(t, rules, "docs/internal/a.md", false, true)
+    assertIgnored(t, rules, "sub/docs/internal", true, false)
+    assertIgnored(t, rules, "a/cache/b", false, true)
+    assertIgnored(t, rules, "#hash", false, true)
+    assertIgnored(t, rules, "main.go", false, false)
+    assertIgnored(t, rules, ignoreFileName, false, true)
+    assertIgnored(t, rules, "", true, false)
+}
+
+func Test_parseIgnore_negatedDir(t *testing.T) {
+    rules := parseIgnore("dist/\n!dist/keep.txt\n")
+    // A file can't be re-included when its parent directory is ignored.
+    assertIgnored(t, rules, "dist/keep.txt", false, true)
+}
+
+func Test_FileAccess_EachSource_ignore(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{
+        ignoreFileName: "internal/\n*.bak\n",
+        "internal/notes.md": "x",
+        "main.go": "x",
+        "main.go.bak": "x"})
+    defer os.RemoveAll(srcDir)
+
+    var found []string
+    newFileAccess(srcDir).EachSource(func(fs FileSource) error {
+        found = append(found, fs.SubPath())
+        return nil
+    })
+
+    if len(found) != 2 || found[0] != "" || found[1] != "main.go" {
+        t.Error("Verify ignored files are not walked", found)
+    }
+}
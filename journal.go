@@ -0,0 +1,195 @@
+package main
+
+import (
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// journal records changes in an existing dest path, so that they can be
+// rolled back when generation fails. Methods of a nil journal do nothing.
+type journal struct {
+    parent string
+    dir string
+    entries []journalEntry
+    mutex sync.Mutex
+}
+
+// journalEntry is a created path when savedPath is empty. Otherwise, an
+// original file of path is moved to savedPath.
+type journalEntry struct {
+    path string
+    savedPath string
+}
+
+// newJournal returns a journal which keeps original files in a directory
+// created under parent when it is needed.
+func newJournal(parent string) *journal {
+    j := new(journal)
+    j.parent = parent
+    return j
+}
+
+// created records a path which doesn't exist before generation.
+func (j *journal) created(path string) {
+    if j == nil {
+        return
+    }
+
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+    j.entries = append(j.entries, journalEntry{path: path})
+}
+
+// moved records an original file which is moved to savedPath.
+func (j *journal) moved(path string, savedPath string) {
+    if j == nil {
+        return
+    }
+
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+    j.entries = append(j.entries, journalEntry{path: path, savedPath: savedPath})
+}
+
+// moveAside moves an existing path into the journal directory. Nothing
+// happens when the path doesn't exist. Without a journal, the path is removed.
+func (j *journal) moveAside(path string) error {
+    if _, err := os.Lstat(path); err != nil {
+        return nil
+    }
+    if j == nil {
+        return os.RemoveAll(path)
+    }
+
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    if j.dir == "" {
+        dir, err := ioutil.TempDir(j.parent, ".gokeleton-journal-")
+        if err != nil {
+            return err
+        }
+        j.dir = dir
+    }
+
+    savedPath := filepath.Join(j.dir, strconv.Itoa(len(j.entries)))
+    err := os.Rename(path, savedPath)
+    if err != nil {
+        return err
+    }
+    j.entries = append(j.entries, journalEntry{path: path, savedPath: savedPath})
+    return nil
+}
+
+// rollback undoes recorded changes from the last one.
+func (j *journal) rollback() (err error) {
+    if j == nil {
+        return nil
+    }
+
+    for i := len(j.entries) - 1; i >= 0; i-- {
+        entry := j.entries[i]
+        var entryErr error
+        if entry.savedPath == "" {
+            entryErr = os.Remove(entry.path)
+        } else {
+            os.RemoveAll(entry.path)
+            entryErr = os.Rename(entry.savedPath, entry.path)
+        }
+        if entryErr != nil && !os.IsNotExist(entryErr) && err == nil {
+            err = entryErr
+        }
+    }
+    j.entries = nil
+
+    if commitErr := j.commit(); err == nil {
+        err = commitErr
+    }
+    return
+}
+
+// commit removes original files kept by the journal.
+func (j *journal) commit() error {
+    if j == nil || j.dir == "" {
+        return nil
+    }
+
+    err := os.RemoveAll(j.dir)
+    j.dir = ""
+    return err
+}
+
+// generateWithJournal calls generate for an existing dest path and rolls
+// back changes in the dest path when it fails.
+func generateWithJournal(da *fileDestAccess, generate func() error) error {
+    parent := da.destPath
+    if isDir, _ := isDirectory(parent); !isDir {
+        parent = filepath.Dir(parent)
+    }
+    da.journal = newJournal(parent)
+
+    err := generate()
+    if err != nil {
+        if rollbackErr := da.journal.rollback(); rollbackErr != nil {
+            fmt.Fprintln(os.Stderr, "Error: failed to roll back:", rollbackErr)
+        }
+        return err
+    }
+    return da.journal.commit()
+}
+
+// generateAtomically calls generate for a new dest path. Files are generated
+// into a sibling path which is renamed to the dest path only on success.
+func generateAtomically(da *fileDestAccess, generate func() error) error {
+    destPath := filepath.Clean(da.destPath)
+    stagePath, err := newStagePath(destPath)
+    if err != nil {
+        return err
+    }
+
+    report := da.report
+    da.destPath = stagePath
+    da.report = func(action string, path string) {
+        report(action, destPath + strings.TrimPrefix(path, stagePath))
+    }
+    defer func() {
+        da.destPath = destPath
+        da.report = report
+    }()
+
+    err = generate()
+    if err == nil {
+        if _, statErr := os.Lstat(stagePath); statErr == nil {
+            err = os.Rename(stagePath, destPath)
+        }
+    }
+    if err != nil {
+        os.RemoveAll(stagePath)
+    }
+    return err
+}
+
+// newStagePath returns a path which doesn't exist next to destPath.
+func newStagePath(destPath string) (string, error) {
+    parent := filepath.Dir(destPath)
+    err := os.MkdirAll(parent, 0777)
+    if err != nil {
+        return "", err
+    }
+
+    // Reserve a unique name and remove it, so that a template of a single
+    // file can be generated as a file.
+    stagePath, err := ioutil.TempDir(parent, "." + filepath.Base(destPath) + ".gokeleton-")
+    if err != nil {
+        return "", err
+    }
+    // Reported paths are cleaned, so a relative path like ./.dest-* is
+    // cleaned as well to be replaced with the dest path.
+    stagePath = filepath.Clean(stagePath)
+    return stagePath, os.Remove(stagePath)
+}
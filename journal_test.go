@@ -0,0 +1,140 @@
+package main
+
+import (
+    "errors"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func Test_journal_rollback(t *testing.T) {
+    destDir := newTemplateDir(t, map[string]string{"a.txt": "old", "b.txt": "old"})
+    defer os.RemoveAll(destDir)
+
+    da := newFileDestAccess(destDir, ConflictOverwrite, nil)
+    da.report = func(action string, path string) {}
+    da.journal = newJournal(destDir)
+    da.WriteFile("a.txt", strings.NewReader("new"), 0644, true)
+    da.MakeDir("sub/dir")
+    da.WriteFile("sub/dir/c.txt", strings.NewReader("new"), 0644, true)
+    da.Symlink("b.txt", "a.txt")
+
+    if err := da.journal.rollback(); err != nil {
+        t.Error("Verify rollback works.", err)
+    }
+
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+    assertString(t, "Verify an overwritten file is restored", "old", string(contents))
+    if isSymlink(filepath.Join(destDir, "b.txt")) {
+        t.Error("Verify a replaced file by a link is restored.")
+    }
+    if _, err := os.Stat(filepath.Join(destDir, "sub")); !os.IsNotExist(err) {
+        t.Error("Verify created directories are removed.", err)
+    }
+    files, _ := ioutil.ReadDir(destDir)
+    if len(files) != 2 {
+        t.Error("Verify a journal directory is removed.", files)
+    }
+}
+
+func Test_journal_rollbackBackup(t *testing.T) {
+    destDir := newTemplateDir(t, map[string]string{"a.txt": "old"})
+    defer os.RemoveAll(destDir)
+
+    da := newFileDestAccess(destDir, ConflictBackup, nil)
+    da.report = func(action string, path string) {}
+    da.journal = newJournal(destDir)
+    da.WriteFile("a.txt", strings.NewReader("new"), 0644, true)
+    da.journal.rollback()
+
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+    assertString(t, "Verify a backup file is restored", "old", string(contents))
+    if isExistingFile(filepath.Join(destDir, "a.txt" + backupSuffix)) {
+        t.Error("Verify a backup file is removed.")
+    }
+}
+
+func Test_generateWithJournal_error(t *testing.T) {
+    destDir := newTemplateDir(t, map[string]string{"a.txt": "old"})
+    defer os.RemoveAll(destDir)
+
+    da := newFileDestAccess(destDir, ConflictFail, nil)
+    da.report = func(action string, path string) {}
+    err := generateWithJournal(da, func() error {
+        da.WriteFile("b.txt", strings.NewReader("new"), 0644, true)
+        return da.WriteFile("a.txt", strings.NewReader("new"), 0644, true)
+    })
+    if !os.IsExist(err) {
+        t.Error("Verify a conflict is returned.", err)
+    }
+    if isExistingFile(filepath.Join(destDir, "b.txt")) {
+        t.Error("Verify a generated file is rolled back.")
+    }
+}
+
+func Test_generateAtomically(t *testing.T) {
+    parentDir, _ := ioutil.TempDir("", "gokeleton-parent")
+    defer os.RemoveAll(parentDir)
+    destDir := filepath.Join(parentDir, "dest")
+
+    var reports []string
+    da := newFileDestAccess(destDir, ConflictFail, nil)
+    da.report = func(action string, path string) {
+        reports = append(reports, action + " " + path)
+    }
+    err := generateAtomically(da, func() error {
+        da.MakeDir("")
+        return da.WriteFile("a.txt", strings.NewReader("new"), 0644, true)
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+    assertString(t, "Verify a file is generated", "new", string(contents))
+    assertString(t, "Verify a dest path is reported", "Create " + filepath.Join(destDir, "a.txt"), strings.Join(reports, "\n"))
+    files, _ := ioutil.ReadDir(parentDir)
+    if len(files) != 1 {
+        t.Error("Verify no staging path is left.", files)
+    }
+}
+
+func Test_generateAtomically_error(t *testing.T) {
+    parentDir, _ := ioutil.TempDir("", "gokeleton-parent")
+    defer os.RemoveAll(parentDir)
+    destDir := filepath.Join(parentDir, "dest")
+
+    da := newFileDestAccess(destDir, ConflictFail, nil)
+    da.report = func(action string, path string) {}
+    err := generateAtomically(da, func() error {
+        da.MakeDir("")
+        da.WriteFile("a.txt", strings.NewReader("new"), 0644, true)
+        return errors.New("network error")
+    })
+    if err == nil {
+        t.Error("Verify an error is returned.")
+    }
+
+    files, _ := ioutil.ReadDir(parentDir)
+    if len(files) != 0 {
+        t.Error("Verify nothing is left.", files)
+    }
+}
+
+func Test_newStagePath_relative(t *testing.T) {
+    parentDir, _ := ioutil.TempDir("", "gokeleton-parent")
+    defer os.RemoveAll(parentDir)
+    wd, _ := os.Getwd()
+    defer os.Chdir(wd)
+    os.Chdir(parentDir)
+
+    stagePath, err := newStagePath("dest")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasPrefix(stagePath, ".dest.gokeleton-") {
+        t.Error("Verify a relative stage path is cleaned.", stagePath)
+    }
+}
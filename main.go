@@ -3,6 +3,6 @@ package main
 import "os"
 
 func main() {
-	cli := &CLI{outStream: os.Stdout, errStream: os.Stderr}
+	cli := &CLI{outStream: os.Stdout, errStream: os.Stderr, inStream: os.Stdin}
 	os.Exit(cli.Run(os.Args))
 }
@@ -0,0 +1,212 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+)
+
+const manifestFileName = ".gokeleton.json"
+const baselineDirName = ".gokeleton/baseline"
+
+// manifest records how a dest path was generated.
+type manifest struct {
+    Version string `json:"version"`
+    Source string `json:"source"`
+    SourceType string `json:"sourceType,omitempty"`
+    Ref string `json:"ref,omitempty"`
+    Revision string `json:"revision,omitempty"`
+    ArchiveHash string `json:"archiveHash,omitempty"`
+    Keywords map[string]string `json:"keywords"`
+    Includes []string `json:"includes"`
+    Excludes []string `json:"excludes"`
+    Skips []string `json:"skips,omitempty"`
+    Raws []string `json:"raws,omitempty"`
+    NoBinaryDetect bool `json:"noBinaryDetect,omitempty"`
+    Engine string `json:"engine,omitempty"`
+    CaseVariants bool `json:"caseVariants,omitempty"`
+    // Files has checksums of files which are written. Files skipped by
+    // a conflict policy are not recorded.
+    Files map[string]string `json:"files"`
+}
+
+// baselineDestAccess writes files to dest and keeps a copy of them
+// as a baseline for `gokeleton update`. A baseline is kept only when
+// a directory is generated.
+type baselineDestAccess struct {
+    dest DestAccess
+    baseline *fileDestAccess
+    started bool
+    disabled bool
+    // checksums are recorded only after dest and baseline files are written.
+    checksums map[string]string
+}
+
+func newBaselineDestAccess(dest DestAccess, destPath string) (da *baselineDestAccess) {
+    da = new(baselineDestAccess)
+    da.dest = dest
+    da.baseline = newFileDestAccess(filepath.Join(destPath, baselineDirName), ConflictOverwrite, nil)
+    da.baseline.report = func(action string, path string) {}
+    da.checksums = map[string]string{}
+    return
+}
+
+// DestAccess
+func (da *baselineDestAccess) MakeDir(subPath string) error {
+    if !da.started {
+        da.started = true
+        if err := da.baseline.journal.moveAside(da.baseline.destPath); err != nil {
+            return err
+        }
+    }
+
+    err := da.dest.MakeDir(subPath)
+    if err != nil || da.disabled {
+        return err
+    }
+    return da.baseline.MakeDir(subPath)
+}
+
+func (da *baselineDestAccess) WriteFile(subPath string, reader io.Reader, mode os.FileMode, replaced bool) error {
+    if !da.started {
+        da.started = true
+        da.disabled = true
+    }
+    if da.disabled {
+        return ignoreSkipped(da.dest.WriteFile(subPath, reader, mode, replaced))
+    }
+
+    // Spool contents to write the baseline only after dest is written,
+    // without keeping them in memory.
+    spool, err := ioutil.TempFile("", "gokeleton-baseline")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(spool.Name())
+    defer spool.Close()
+
+    hash := sha256.New()
+    _, err = io.Copy(io.MultiWriter(spool, hash), reader)
+    if err == nil {
+        _, err = spool.Seek(0, io.SeekStart)
+    }
+    if err == nil {
+        err = da.dest.WriteFile(subPath, spool, mode, replaced)
+    }
+    if err == errSkipped {
+        // A file which is not generated is not a baseline.
+        return nil
+    }
+    if err == nil {
+        _, err = spool.Seek(0, io.SeekStart)
+    }
+    if err == nil {
+        err = da.baseline.WriteFile(subPath, spool, mode, replaced)
+    }
+    if err != nil {
+        return err
+    }
+    da.checksums[filepath.ToSlash(subPath)] = checksumString(hash.Sum(nil))
+    return nil
+}
+
+func (da *baselineDestAccess) Symlink(subPath string, target string) error {
+    if !da.started {
+        da.started = true
+        da.disabled = true
+    }
+
+    err := da.dest.Symlink(subPath, target)
+    if err != nil || da.disabled {
+        return ignoreSkipped(err)
+    }
+    return da.baseline.Symlink(subPath, target)
+}
+
+// ignoreSkipped returns nil for errSkipped because skipping a file is not
+// a failure of generation.
+func ignoreSkipped(err error) error {
+    if err == errSkipped {
+        return nil
+    }
+    return err
+}
+
+func (da *baselineDestAccess) isRecorded() bool {
+    return da.started && !da.disabled
+}
+
+// setGenerated sets the tool version, the revision of a source and
+// checksums of generated files.
+func (m *manifest) setGenerated(sa SourceAccess, da *baselineDestAccess) {
+    m.Version = Version
+    m.Revision = ""
+    m.ArchiveHash = ""
+    if sr, ok := sa.(SourceRevision); ok {
+        m.Revision = sr.Revision()
+        m.ArchiveHash = sr.ArchiveHash()
+    }
+    m.Files = da.checksums
+}
+
+func checksum(contents []byte) string {
+    hash := sha256.Sum256(contents)
+    return checksumString(hash[:])
+}
+
+func checksumString(sum []byte) string {
+    return "sha256:" + hex.EncodeToString(sum)
+}
+
+func readManifest(destPath string) (m *manifest, err error) {
+    contents, err := ioutil.ReadFile(filepath.Join(destPath, manifestFileName))
+    if err != nil {
+        return nil, err
+    }
+    m = new(manifest)
+    err = json.Unmarshal(contents, m)
+    return
+}
+
+func writeManifest(destPath string, m *manifest) error {
+    contents, err := json.MarshalIndent(m, "", "  ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(filepath.Join(destPath, manifestFileName), append(contents, '\n'), 0666)
+}
+
+// writeJournaledManifest writes a manifest and keeps an original one in j
+// to roll back.
+func writeJournaledManifest(destPath string, m *manifest, j *journal) error {
+    manifestPath := filepath.Join(destPath, manifestFileName)
+    if err := j.moveAside(manifestPath); err != nil {
+        return err
+    }
+    j.created(manifestPath)
+    return writeManifest(destPath, m)
+}
+
+// manifestSource returns srcPath to be used from any working directory.
+func manifestSource(srcPath string) string {
+    if isRemoteSource(srcPath) {
+        return srcPath
+    }
+
+    location, subPath := srcPath, ""
+    if isGitSource(srcPath) || isArchiveSource(srcPath) {
+        location, subPath = splitSubPath(srcPath)
+    }
+    absPath, err := filepath.Abs(location)
+    if err != nil {
+        return srcPath
+    }
+    if subPath != "" {
+        return absPath + "//" + subPath
+    }
+    return absPath
+}
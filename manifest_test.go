@@ -0,0 +1,97 @@
+package main
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+type revisionSourceAccess struct {
+    fileAccess
+}
+
+func (sa *revisionSourceAccess) Revision() string {
+    return "abc"
+}
+
+func (sa *revisionSourceAccess) ArchiveHash() string {
+    return "sha256:def"
+}
+
+func Test_checksum(t *testing.T) {
+    assertString(t, "Verify sha256 checksum is returned",
+        "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", checksum([]byte("abc")))
+}
+
+func Test_manifest_setGenerated(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+
+    da := newBaselineDestAccess(newMemoryDestAccess(), destDir)
+    da.MakeDir("")
+    da.WriteFile("a.txt", strings.NewReader("abc"), 0644, true)
+
+    m := new(manifest)
+    m.setGenerated(&revisionSourceAccess{}, da)
+    assertString(t, "Verify version is set", Version, m.Version)
+    assertString(t, "Verify revision is set", "abc", m.Revision)
+    assertString(t, "Verify archive hash is set", "sha256:def", m.ArchiveHash)
+    assertString(t, "Verify checksum is set", checksum([]byte("abc")), m.Files["a.txt"])
+}
+
+func Test_writeManifest_readManifest(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+
+    err := writeManifest(destDir, &manifest{Source: "https://github.com/hata/gorep", Keywords: map[string]string{"foo": "bar"}})
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+    m, err := readManifest(destDir)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+    assertString(t, "Verify source is read", "https://github.com/hata/gorep", m.Source)
+    assertString(t, "Verify keywords are read", "bar", m.Keywords["foo"])
+}
+
+func Test_baselineDestAccess_WriteFile_conflict(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+    ioutil.WriteFile(filepath.Join(destDir, "a.txt"), []byte("old"), 0666)
+
+    da := newBaselineDestAccess(newFileDestAccess(destDir, ConflictFail, nil), destDir)
+    da.MakeDir("")
+    if err := da.WriteFile("a.txt", strings.NewReader("new"), 0644, true); err == nil {
+        t.Error("Verify a conflict is an error.")
+    }
+    if _, err := os.Stat(filepath.Join(destDir, baselineDirName, "a.txt")); !os.IsNotExist(err) {
+        t.Error("Verify a baseline is not written when dest is not written.", err)
+    }
+    if _, ok := da.checksums["a.txt"]; ok {
+        t.Error("Verify a checksum is not recorded.")
+    }
+}
+
+func Test_baselineDestAccess_skip(t *testing.T) {
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+    ioutil.WriteFile(filepath.Join(destDir, "a.txt"), []byte("old"), 0666)
+    os.Symlink("old.txt", filepath.Join(destDir, "link"))
+
+    da := newBaselineDestAccess(newFileDestAccess(destDir, ConflictSkip, nil), destDir)
+    da.MakeDir("")
+    if err := da.WriteFile("a.txt", strings.NewReader("new"), 0644, true); err != nil {
+        t.Error("Verify a skipped file is not an error.", err)
+    }
+    if err := da.Symlink("link", "new.txt"); err != nil {
+        t.Error("Verify a skipped link is not an error.", err)
+    }
+    for _, name := range []string{"a.txt", "link"} {
+        if _, err := os.Lstat(filepath.Join(destDir, baselineDirName, name)); !os.IsNotExist(err) {
+            t.Error("Verify a skipped file is not a baseline.", name, err)
+        }
+    }
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+    "path"
+    "regexp"
+    "strings"
+)
+
+const regexpPatternPrefix = "re:"
+
+// pathMatcher matches sub paths with patterns. A pattern is one of
+//   - *                  matches everything
+//   - re:<regexp>        matches a sub path by a regular expression
+//   - a glob like *.go, cmd/**/*.go or vendor/
+//   - a suffix like .txt
+// A glob without / matches a base name at any depth. A glob which ends with /
+// matches a directory and everything under it. ** matches any directories.
+type pathMatcher struct {
+    patterns []*pathPattern
+}
+
+type pathPattern struct {
+    all bool
+    suffix string
+    glob []string
+    baseNameOnly bool
+    re *regexp.Regexp
+}
+
+func newPathMatcher(patterns []string) (m *pathMatcher, err error) {
+    m = new(pathMatcher)
+    for _, pattern := range patterns {
+        var p *pathPattern
+        p, err = newPathPattern(pattern)
+        if err != nil {
+            return nil, err
+        }
+        if p != nil {
+            m.patterns = append(m.patterns, p)
+        }
+    }
+    return
+}
+
+func newPathPattern(pattern string) (p *pathPattern, err error) {
+    if pattern == "" {
+        return nil, nil
+    }
+
+    p = new(pathPattern)
+    switch {
+    case pattern == "*":
+        p.all = true
+    case strings.HasPrefix(pattern, regexpPatternPrefix):
+        p.re, err = regexp.Compile(pattern[len(regexpPatternPrefix):])
+    case strings.ContainsAny(pattern, "*?[/"):
+        pattern = strings.TrimPrefix(pattern, "/")
+        if strings.HasSuffix(pattern, "/") {
+            pattern += "**"
+        }
+        p.baseNameOnly = !strings.Contains(pattern, "/")
+        p.glob = strings.Split(pattern, "/")
+        for _, elem := range p.glob {
+            if _, err = path.Match(elem, ""); err != nil {
+                return nil, err
+            }
+        }
+    default:
+        p.suffix = pattern
+    }
+    return
+}
+
+// match returns true when a sub path matches one of patterns.
+func (m *pathMatcher) match(subPath string) bool {
+    subPath = toSlashSubPath(subPath)
+    for _, p := range m.patterns {
+        if p.match(subPath) {
+            return true
+        }
+    }
+    return false
+}
+
+// matchDir returns true when everything under a directory matches
+// one of patterns. Files under the directory don't have to be checked.
+func (m *pathMatcher) matchDir(subPath string) bool {
+    subPath = toSlashSubPath(subPath)
+    for _, p := range m.patterns {
+        if p.matchDir(subPath) {
+            return true
+        }
+    }
+    return false
+}
+
+func (p *pathPattern) match(subPath string) bool {
+    switch {
+    case p.all:
+        return true
+    case p.re != nil:
+        return p.re.MatchString(subPath)
+    case p.glob != nil:
+        if p.baseNameOnly {
+            return matchGlob(p.glob, []string{path.Base(subPath)})
+        }
+        return matchGlob(p.glob, strings.Split(subPath, "/")) || p.matchDir(subPath)
+    }
+    return strings.HasSuffix(subPath, p.suffix)
+}
+
+func (p *pathPattern) matchDir(subPath string) bool {
+    switch {
+    case p.all:
+        return true
+    case p.glob != nil && !p.baseNameOnly && p.glob[len(p.glob) - 1] == "**":
+        // The directory or one of its parents is the base of **.
+        elems := strings.Split(subPath, "/")
+        for i := len(elems); i > 0; i-- {
+            if matchGlob(p.glob[:len(p.glob) - 1], elems[:i]) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// matchGlob matches path elements with glob elements. ** matches
+// zero or more elements.
+func matchGlob(glob []string, elems []string) bool {
+    for len(glob) > 0 {
+        if glob[0] == "**" {
+            for i := 0; i <= len(elems); i++ {
+                if matchGlob(glob[1:], elems[i:]) {
+                    return true
+                }
+            }
+            return false
+        }
+
+        if len(elems) == 0 {
+            return false
+        }
+        if ok, _ := path.Match(glob[0], elems[0]); !ok {
+            return false
+        }
+        glob = glob[1:]
+        elems = elems[1:]
+    }
+    return len(elems) == 0
+}
+
+func toSlashSubPath(subPath string) string {
+    return strings.TrimSuffix(strings.Replace(subPath, pathSep(), "/", -1), "/")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+func newTestFilter(t *testing.T, includes string, excludes string) *sourceFilter {
+    return newTestFilterWith(t, includes, excludes, "", "")
+}
+
+func newTestFilterWith(t *testing.T, includes string, excludes string, skips string, raws string) *sourceFilter {
+    filter, err := newSourceFilter(toList(includes, ","), toList(excludes, ","), toList(skips, ","), toList(raws, ","))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return filter
+}
+
+func assertMatch(t *testing.T, pattern string, subPath string, expected bool) {
+    m, err := newPathMatcher([]string{pattern})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if m.match(subPath) != expected {
+        t.Errorf("Verify %s matches %s: %v", pattern, subPath, expected)
+    }
+}
+
+func Test_pathMatcher_suffix(t *testing.T) {
+    assertMatch(t, ".txt", "a/b.txt", true)
+    assertMatch(t, ".txt", "a/b.go", false)
+    assertMatch(t, "*", "a/b.go", true)
+}
+
+func Test_pathMatcher_suffixes_matched(t *testing.T) {
+    m, _ := newPathMatcher([]string{".foo", ".txt"})
+    if !m.match("/tmp/test.txt") {
+        t.Error("Verify .txt should be matched.")
+    }
+}
+
+func Test_pathMatcher_suffixes_unmatched(t *testing.T) {
+    m, _ := newPathMatcher([]string{".foo"})
+    if m.match("/tmp/test.txt") {
+        t.Error("Verify unmatched suffix")
+    }
+}
+
+func Test_pathMatcher_wildcard(t *testing.T) {
+    m, _ := newPathMatcher([]string{"*"})
+    if !m.match("/tmp/test.txt") {
+        t.Error("Verify wildcard match everything")
+    }
+}
+
+func Test_pathMatcher_glob(t *testing.T) {
+    assertMatch(t, "*.go", "main.go", true)
+    assertMatch(t, "*.go", "cmd/app/main.go", true)
+    assertMatch(t, "cmd/**/*.go", "cmd/main.go", true)
+    assertMatch(t, "cmd/**/*.go", "cmd/app/sub/main.go", true)
+    assertMatch(t, "cmd/**/*.go", "pkg/main.go", false)
+    assertMatch(t, ".github/workflows/*.yml", ".github/workflows/ci.yml", true)
+    assertMatch(t, ".github/workflows/*.yml", ".github/workflows/sub/ci.yml", false)
+    assertMatch(t, "vendor/**", "vendor/github.com/a/a.go", true)
+    assertMatch(t, "vendor/**", "pkg/vendor/a.go", false)
+    assertMatch(t, "vendor/", "vendor", true)
+    assertMatch(t, "vendor/", "vendor/a.go", true)
+    assertMatch(t, "/docs/*.md", "docs/a.md", true)
+    assertMatch(t, "file?.txt", "file1.txt", true)
+}
+
+func Test_pathMatcher_regexp(t *testing.T) {
+    assertMatch(t, "re:^cmd/.*_test\\.go$", "cmd/a/a_test.go", true)
+    assertMatch(t, "re:^cmd/.*_test\\.go$", "pkg/a_test.go", false)
+}
+
+func Test_pathMatcher_invalid(t *testing.T) {
+    if _, err := newPathMatcher([]string{"re:("}); err == nil {
+        t.Error("Verify an invalid regexp is an error")
+    }
+    if _, err := newPathMatcher([]string{"a/[b"}); err == nil {
+        t.Error("Verify an invalid glob is an error")
+    }
+}
+
+func Test_pathMatcher_matchDir(t *testing.T) {
+    m, _ := newPathMatcher([]string{"vendor/**", "*.go", "docs/"})
+    if !m.matchDir("vendor") || !m.matchDir("vendor/github.com") || !m.matchDir("docs/") {
+        t.Error("Verify everything under directories is matched")
+    }
+    if m.matchDir("cmd") {
+        t.Error("Verify a base name pattern doesn't match a whole directory")
+    }
+}
+
+func Test_copyEachFileSource_globExcludes(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{
+        "vendor/lib/foo.go": "foo",
+        "cmd/foo/main.go": "foo",
+        "foo.txt": "foo"})
+    defer os.RemoveAll(srcDir)
+
+    da := newMemoryDestAccess()
+    err := copyEachFileSource(newFileAccess(srcDir), da, newTestFilter(t, "cmd/**/*.go,vendor/**", "vendor/**"), newReplaceFunc(map[string]string{"foo": "bar"}), nil)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+
+    files := map[string]string{}
+    for _, file := range da.files {
+        files[file.subPath] = string(file.contents)
+    }
+    assertString(t, "Verify an included file is replaced", "bar", files["cmd/bar/main.go"])
+    assertString(t, "Verify an excluded directory is copied verbatim", "foo", files["vendor/lib/bar.go"])
+    assertString(t, "Verify a file which is not included is copied verbatim", "foo", files["bar.txt"])
+}
+
+func Test_copyEachFileSource_skipAndRaw(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{
+        ".git/config": "foo",
+        "docs/template.md": "foo",
+        "foo/fixture.txt": "foo",
+        "foo/main.go": "foo",
+        "gokeleton.yaml": "skip: [docs/]\nraw: ['*.txt']\n"})
+    defer os.RemoveAll(srcDir)
+
+    sa := newFileAccess(srcDir)
+    schema, _ := loadSchema(sa)
+    filter := newTestFilterWith(t, "*", "", strings.Join(append(schema.Skip, ".git/"), ","), strings.Join(schema.Raw, ","))
+
+    da := newMemoryDestAccess()
+    err := copyEachFileSource(sa, da, filter, newReplaceFunc(map[string]string{"foo": "bar"}), nil)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+
+    files := map[string]string{}
+    for _, file := range da.files {
+        files[file.subPath] = string(file.contents)
+    }
+    if len(files) != 2 {
+        t.Error("Verify skipped files are not generated", files)
+    }
+    assertString(t, "Verify a file is replaced", "bar", files["bar/main.go"])
+    assertString(t, "Verify a raw file is copied verbatim in a replaced directory", "foo", files["bar/fixture.txt"])
+    for _, dir := range da.dirs {
+        if dir == ".git" || dir == "docs" {
+            t.Error("Verify a skipped directory is not generated", dir)
+        }
+    }
+}
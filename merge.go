@@ -0,0 +1,159 @@
+package main
+
+import (
+    "strings"
+)
+
+const (
+    conflictStartMarker = "<<<<<<< local\n"
+    conflictSepMarker = "=======\n"
+    conflictEndMarker = ">>>>>>> template\n"
+)
+
+// maxLCSCells limits the size of the table to match lines. Changed regions
+// larger than this are handled as a whole instead of line by line.
+const maxLCSCells = 4000000
+
+// merge3 merges changes from base to ours and from base to theirs line by line.
+// Regions changed on both sides differently are kept with conflict markers.
+func merge3(base string, ours string, theirs string) (merged string, conflict bool) {
+    baseLines := splitLines(base)
+    oursLines := splitLines(ours)
+    theirsLines := splitLines(theirs)
+    toOurs := matchLines(baseLines, oursLines)
+    toTheirs := matchLines(baseLines, theirsLines)
+
+    var out []string
+    i, j, k := 0, 0, 0
+    for {
+        for i < len(baseLines) && toOurs[i] == j && toTheirs[i] == k {
+            out = append(out, baseLines[i])
+            i++
+            j++
+            k++
+        }
+        if i == len(baseLines) && j == len(oursLines) && k == len(theirsLines) {
+            break
+        }
+
+        b := i
+        for b < len(baseLines) && (toOurs[b] < 0 || toTheirs[b] < 0) {
+            b++
+        }
+        oursEnd, theirsEnd := len(oursLines), len(theirsLines)
+        if b < len(baseLines) {
+            oursEnd, theirsEnd = toOurs[b], toTheirs[b]
+        }
+
+        baseChunk := baseLines[i:b]
+        oursChunk := oursLines[j:oursEnd]
+        theirsChunk := theirsLines[k:theirsEnd]
+
+        if equalLines(oursChunk, baseChunk) {
+            out = append(out, theirsChunk...)
+        } else if equalLines(theirsChunk, baseChunk) || equalLines(oursChunk, theirsChunk) {
+            out = append(out, oursChunk...)
+        } else {
+            conflict = true
+            out = append(out, conflictStartMarker)
+            out = appendChunk(out, oursChunk)
+            out = append(out, conflictSepMarker)
+            out = appendChunk(out, theirsChunk)
+            out = append(out, conflictEndMarker)
+        }
+
+        i, j, k = b, oursEnd, theirsEnd
+    }
+
+    return strings.Join(out, ""), conflict
+}
+
+// matchLines returns the index of b matched to each line of a
+// by the longest common subsequence. -1 is set for unmatched lines.
+func matchLines(a []string, b []string) []int {
+    matched := make([]int, len(a))
+    for i := range matched {
+        matched[i] = -1
+    }
+
+    prefix := 0
+    for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+        matched[prefix] = prefix
+        prefix++
+    }
+    suffix := 0
+    for suffix < len(a) - prefix && suffix < len(b) - prefix && a[len(a) - 1 - suffix] == b[len(b) - 1 - suffix] {
+        matched[len(a) - 1 - suffix] = len(b) - 1 - suffix
+        suffix++
+    }
+
+    midA := a[prefix:len(a) - suffix]
+    midB := b[prefix:len(b) - suffix]
+    if len(midA) == 0 || len(midB) == 0 || len(midA) * len(midB) > maxLCSCells {
+        return matched
+    }
+
+    // lengths[x][y] is the LCS length of midA[x:] and midB[y:]
+    lengths := make([][]int, len(midA) + 1)
+    for x := range lengths {
+        lengths[x] = make([]int, len(midB) + 1)
+    }
+    for x := len(midA) - 1; x >= 0; x-- {
+        for y := len(midB) - 1; y >= 0; y-- {
+            if midA[x] == midB[y] {
+                lengths[x][y] = lengths[x + 1][y + 1] + 1
+            } else if lengths[x + 1][y] >= lengths[x][y + 1] {
+                lengths[x][y] = lengths[x + 1][y]
+            } else {
+                lengths[x][y] = lengths[x][y + 1]
+            }
+        }
+    }
+
+    for x, y := 0, 0; x < len(midA) && y < len(midB); {
+        if midA[x] == midB[y] {
+            matched[prefix + x] = prefix + y
+            x++
+            y++
+        } else if lengths[x + 1][y] >= lengths[x][y + 1] {
+            x++
+        } else {
+            y++
+        }
+    }
+
+    return matched
+}
+
+func splitLines(s string) []string {
+    if len(s) == 0 {
+        return nil
+    }
+    lines := strings.SplitAfter(s, "\n")
+    if lines[len(lines) - 1] == "" {
+        lines = lines[:len(lines) - 1]
+    }
+    return lines
+}
+
+func equalLines(a []string, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+// appendChunk appends lines and terminates the last line to keep a marker
+// at the beginning of a line.
+func appendChunk(out []string, lines []string) []string {
+    out = append(out, lines...)
+    if len(lines) > 0 && !strings.HasSuffix(lines[len(lines) - 1], "\n") {
+        out = append(out, "\n")
+    }
+    return out
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+    "testing"
+)
+
+func Test_merge3_theirsOnly(t *testing.T) {
+    merged, conflict := merge3("a\nb\nc\n", "a\nb\nc\n", "a\nB\nc\n")
+    assertString(t, "Verify template change is applied", "a\nB\nc\n", merged)
+    if conflict {
+        t.Error("Verify no conflict found")
+    }
+}
+
+func Test_merge3_bothSides(t *testing.T) {
+    merged, conflict := merge3("a\nb\nc\nd\n", "A\nb\nc\nd\n", "a\nb\nc\nD\n")
+    assertString(t, "Verify both changes are applied", "A\nb\nc\nD\n", merged)
+    if conflict {
+        t.Error("Verify no conflict found")
+    }
+}
+
+func Test_merge3_sameChange(t *testing.T) {
+    merged, conflict := merge3("a\nb\n", "a\nx\n", "a\nx\n")
+    assertString(t, "Verify the same change is applied once", "a\nx\n", merged)
+    if conflict {
+        t.Error("Verify no conflict found")
+    }
+}
+
+func Test_merge3_conflict(t *testing.T) {
+    merged, conflict := merge3("a\nb\nc\n", "a\nlocal\nc\n", "a\ntemplate\nc\n")
+    expected := "a\n" + conflictStartMarker + "local\n" + conflictSepMarker + "template\n" + conflictEndMarker + "c\n"
+    assertString(t, "Verify conflict markers are written", expected, merged)
+    if !conflict {
+        t.Error("Verify conflict is found")
+    }
+}
+
+func Test_merge3_insertions(t *testing.T) {
+    merged, conflict := merge3("a\nb\n", "a\nb\nlocal\n", "top\na\nb\n")
+    assertString(t, "Verify insertions are merged", "top\na\nb\nlocal\n", merged)
+    if conflict {
+        t.Error("Verify no conflict found")
+    }
+}
+
+func Test_merge3_noNewLineAtEnd(t *testing.T) {
+    merged, conflict := merge3("a", "b", "c")
+    expected := conflictStartMarker + "b\n" + conflictSepMarker + "c\n" + conflictEndMarker
+    assertString(t, "Verify markers start at a line", expected, merged)
+    if !conflict {
+        t.Error("Verify conflict is found")
+    }
+}
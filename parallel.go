@@ -0,0 +1,148 @@
+package main
+
+import (
+    "sync"
+)
+
+// parallelDestAccess is implemented by DestAccess which can be written by
+// parallel workers. task returns DestAccess for a file and flush which
+// applies what the file has reported. flush is called in the order of files.
+type parallelDestAccess interface {
+    DestAccess
+    task() (taskDA DestAccess, flush func())
+}
+
+// fileTask is a file which is generated by a worker.
+type fileTask struct {
+    fileSource FileSource
+    raw bool
+}
+
+type reportEntry struct {
+    action string
+    path string
+}
+
+// copyEachFileSourceParallel generates files by jobs workers. All sources are
+// enumerated first and directories and symbolic links are created in order.
+// Then, files are generated in parallel and their reports are flushed in the
+// order of files. No more files are started after the first error.
+func copyEachFileSourceParallel(sa SourceAccess, da DestAccess, filter *sourceFilter, handler ReplaceFunc, stream StreamReplaceFunc, jobs int) error {
+    pda, ok := da.(parallelDestAccess)
+    if jobs <= 1 || !ok {
+        return copyEachFileSource(sa, da, filter, handler, stream)
+    }
+
+    var tasks []fileTask
+    err := walkFileSources(sa, da, filter, handler, func(fileSource FileSource, raw bool) error {
+        tasks = append(tasks, fileTask{fileSource: fileSource, raw: raw})
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+
+    var mutex sync.Mutex
+    var firstErr error
+    flushes := make([]func(), len(tasks))
+    next := 0
+
+    indexes := make(chan int)
+    var wg sync.WaitGroup
+    for i := 0; i < jobs; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for index := range indexes {
+                mutex.Lock()
+                taskDA, flush := pda.task()
+                mutex.Unlock()
+
+                err := copyFileSource(tasks[index].fileSource, tasks[index].raw, taskDA, filter, handler, stream)
+
+                mutex.Lock()
+                if err != nil && firstErr == nil {
+                    firstErr = err
+                }
+                flushes[index] = flush
+                for next < len(tasks) && flushes[next] != nil {
+                    flushes[next]()
+                    next++
+                }
+                mutex.Unlock()
+            }
+        }()
+    }
+
+    for index := range tasks {
+        mutex.Lock()
+        failed := firstErr != nil
+        mutex.Unlock()
+        if failed {
+            break
+        }
+        indexes <- index
+    }
+    close(indexes)
+    wg.Wait()
+
+    return firstErr
+}
+
+// parallelDestAccess
+func (da *fileDestAccess) task() (DestAccess, func()) {
+    var reports []reportEntry
+    taskDA := *da
+    taskDA.report = func(action string, path string) {
+        reports = append(reports, reportEntry{action: action, path: path})
+    }
+
+    return &taskDA, func() {
+        for _, entry := range reports {
+            da.report(entry.action, entry.path)
+        }
+    }
+}
+
+// parallelDestAccess
+func (da *memoryDestAccess) task() (DestAccess, func()) {
+    taskDA := newMemoryDestAccess()
+    return taskDA, func() {
+        da.dirs = append(da.dirs, taskDA.dirs...)
+        da.files = append(da.files, taskDA.files...)
+        da.links = append(da.links, taskDA.links...)
+    }
+}
+
+// parallelDestAccess
+func (da *dryRunDestAccess) task() (DestAccess, func()) {
+    // A task shares planned entries to decide a dest file path, but its own
+    // entries are appended to a new array.
+    planned := len(da.entries)
+    taskDA := *da
+    taskDA.entries = da.entries[:planned:planned]
+
+    return &taskDA, func() {
+        da.entries = append(da.entries, taskDA.entries[planned:]...)
+    }
+}
+
+// parallelDestAccess
+func (da *baselineDestAccess) task() (DestAccess, func()) {
+    // A dest which doesn't have tasks has to be safe for parallel workers.
+    taskDest, flushDest := da.dest, func() {}
+    if dest, ok := da.dest.(parallelDestAccess); ok {
+        taskDest, flushDest = dest.task()
+    }
+
+    taskDA := *da
+    taskDA.dest = taskDest
+    taskDA.checksums = map[string]string{}
+
+    return &taskDA, func() {
+        for subPath, sum := range taskDA.checksums {
+            da.checksums[subPath] = sum
+        }
+        flushDest()
+    }
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "strings"
+    "testing"
+)
+
+func newParallelTemplateDir(t *testing.T) string {
+    files := map[string]string{}
+    for i := 0; i < 50; i++ {
+        files[fmt.Sprintf("dir%d/foo%02d.txt", i % 3, i)] = strings.Repeat("foo ", i * 100)
+    }
+    return newTemplateDir(t, files)
+}
+
+func Test_copyEachFileSourceParallel_reportOrder(t *testing.T) {
+    srcDir := newParallelTemplateDir(t)
+    defer os.RemoveAll(srcDir)
+
+    var reports [2][]string
+    for i, jobs := range []int{1, 8} {
+        destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+        defer os.RemoveAll(destDir)
+
+        fileDA := newFileDestAccess(destDir, ConflictOverwrite, nil)
+        fileDA.report = func(action string, path string) {
+            reports[i] = append(reports[i], action + " " + toSubPath(destDir, path))
+        }
+        da := newBaselineDestAccess(fileDA, destDir)
+        err := copyEachFileSourceParallel(newFileAccess(srcDir), da, newTestFilter(t, "*", ""),
+            newReplaceFunc(map[string]string{"foo": "bar"}), nil, jobs)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(da.checksums) != 50 {
+            t.Error("Verify checksums of all files are recorded.", len(da.checksums))
+        }
+    }
+
+    assertString(t, "Verify reports are in the same order", strings.Join(reports[0], "\n"), strings.Join(reports[1], "\n"))
+}
+
+func Test_copyEachFileSourceParallel_dryRun(t *testing.T) {
+    srcDir := newParallelTemplateDir(t)
+    defer os.RemoveAll(srcDir)
+
+    // Directories are planned before files in parallel, so outputs of
+    // different numbers of workers are compared.
+    var outs [2]string
+    for i, jobs := range []int{2, 8} {
+        da := newDryRunDestAccess("/tmp/gokeleton-dest-not-found", ConflictFail)
+        err := copyEachFileSourceParallel(newFileAccess(srcDir), da, newTestFilter(t, "*", ""),
+            newReplaceFunc(map[string]string{"foo": "bar"}), nil, jobs)
+        if err != nil {
+            t.Fatal(err)
+        }
+        out := new(strings.Builder)
+        da.report(out)
+        outs[i] = out.String()
+    }
+
+    assertString(t, "Verify planned entries are in the same order", outs[0], outs[1])
+}
+
+type errorFileSource struct {
+    FileSource
+}
+
+func (fs *errorFileSource) Reader() (io.ReadCloser, error) {
+    return nil, errors.New("read error")
+}
+
+type errorSourceAccess struct {
+    sa SourceAccess
+    failed string
+}
+
+func (sa *errorSourceAccess) EachSource(callback FileSourceFunc) error {
+    return sa.sa.EachSource(func(fileSource FileSource) error {
+        if fileSource.SubPath() == sa.failed {
+            return callback(&errorFileSource{fileSource})
+        }
+        return callback(fileSource)
+    })
+}
+
+func Test_copyEachFileSourceParallel_error(t *testing.T) {
+    srcDir := newParallelTemplateDir(t)
+    defer os.RemoveAll(srcDir)
+
+    sa := &errorSourceAccess{sa: newFileAccess(srcDir), failed: "dir0/foo00.txt"}
+    da := newMemoryDestAccess()
+    err := copyEachFileSourceParallel(sa, da, newTestFilter(t, "*", ""), newReplaceFunc(map[string]string{}), nil, 4)
+    if err == nil || err.Error() != "read error" {
+        t.Error("Verify the first error is returned.", err)
+    }
+    if len(da.files) == 50 {
+        t.Error("Verify remaining files are not generated after an error.")
+    }
+}
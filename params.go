@@ -0,0 +1,175 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/BurntSushi/toml"
+    "gopkg.in/yaml.v2"
+    "io/ioutil"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// loadParamsFile reads parameters from a YAML, JSON, TOML or .env file.
+// The format is decided by the extension of the file.
+func loadParamsFile(path string) (params map[string]string, err error) {
+    contents, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    values := map[string]interface{}{}
+    switch ext := strings.ToLower(filepath.Ext(path)); {
+    case ext == ".yaml" || ext == ".yml":
+        err = yaml.Unmarshal(contents, &values)
+    case ext == ".json":
+        // Numbers are kept as written instead of float64 like 1e+07.
+        decoder := json.NewDecoder(bytes.NewReader(contents))
+        decoder.UseNumber()
+        err = decoder.Decode(&values)
+    case ext == ".toml":
+        _, err = toml.Decode(string(contents), &values)
+    case ext == ".env" || filepath.Base(path) == ".env":
+        return parseDotEnv(string(contents))
+    default:
+        return nil, errors.New("Unknown params file format: " + path)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("%s: %s", path, err)
+    }
+
+    params = map[string]string{}
+    for key, value := range values {
+        switch value.(type) {
+        case string, bool, int, int64, float64, json.Number, nil:
+            params[key] = scalarString(value)
+        default:
+            return nil, fmt.Errorf("%s: parameter %s is not a string, number or bool", path, key)
+        }
+    }
+    return
+}
+
+func scalarString(value interface{}) string {
+    switch v := value.(type) {
+    case nil:
+        return ""
+    case float64:
+        return strconv.FormatFloat(v, 'f', -1, 64)
+    }
+    return fmt.Sprint(value)
+}
+
+// parseDotEnv parses KEY=VALUE lines. A value can be quoted by "..." which
+// may have escapes and new lines, or by '...' which is used as is.
+func parseDotEnv(contents string) (params map[string]string, err error) {
+    params = map[string]string{}
+    lineNo := 0
+
+    for len(contents) > 0 {
+        var line string
+        lineNo++
+        line, contents = cutLine(contents)
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        line = strings.TrimPrefix(line, "export ")
+
+        index := strings.IndexByte(line, '=')
+        if index <= 0 {
+            return nil, fmt.Errorf(".env line %d: expected KEY=VALUE", lineNo)
+        }
+        key := strings.TrimSpace(line[:index])
+        value := strings.TrimSpace(line[index + 1:])
+
+        switch {
+        case strings.HasPrefix(value, "\""):
+            // A double quoted value continues until a closing quote.
+            end := closingQuote(value)
+            for end < 0 && len(contents) > 0 {
+                var next string
+                lineNo++
+                next, contents = cutLine(contents)
+                value += "\n" + next
+                end = closingQuote(value)
+            }
+            if end < 0 {
+                return nil, fmt.Errorf(".env line %d: unterminated quoted value of %s", lineNo, key)
+            }
+            value, err = strconv.Unquote(strings.Replace(value[:end + 1], "\n", "\\n", -1))
+            if err != nil {
+                return nil, fmt.Errorf(".env line %d: %s", lineNo, err)
+            }
+        case strings.HasPrefix(value, "'"):
+            end := strings.LastIndex(value, "'")
+            if end == 0 {
+                return nil, fmt.Errorf(".env line %d: unterminated quoted value of %s", lineNo, key)
+            }
+            value = value[1:end]
+        default:
+            if index = strings.Index(value, " #"); index >= 0 {
+                value = strings.TrimSpace(value[:index])
+            }
+        }
+
+        params[key] = value
+    }
+
+    return
+}
+
+func cutLine(s string) (line string, rest string) {
+    if index := strings.IndexByte(s, '\n'); index >= 0 {
+        return strings.TrimSuffix(s[:index], "\r"), s[index + 1:]
+    }
+    return s, ""
+}
+
+// closingQuote returns the index of " which closes a value starting with ".
+func closingQuote(value string) int {
+    escaped := false
+    for i := 1; i < len(value); i++ {
+        switch {
+        case escaped:
+            escaped = false
+        case value[i] == '\\':
+            escaped = true
+        case value[i] == '"':
+            return i
+        }
+    }
+    return -1
+}
+
+// envParams returns parameters from environment variables which have
+// the prefix. The prefix is removed from a parameter name.
+func envParams(prefix string, environ []string) map[string]string {
+    params := map[string]string{}
+    if prefix == "" {
+        return params
+    }
+
+    for _, kv := range environ {
+        index := strings.IndexByte(kv, '=')
+        if index < 0 || !strings.HasPrefix(kv[:index], prefix) || index == len(prefix) {
+            continue
+        }
+        params[kv[len(prefix):index]] = kv[index + 1:]
+    }
+    return params
+}
+
+// mergeParams merges parameters. Latter ones take precedence.
+func mergeParams(paramsList ...map[string]string) map[string]string {
+    merged := map[string]string{}
+    for _, params := range paramsList {
+        for key, value := range params {
+            merged[key] = value
+        }
+    }
+    return merged
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func writeParamsFile(t *testing.T, name string, contents string) string {
+    dir, _ := ioutil.TempDir("", "gokeleton-params")
+    path := filepath.Join(dir, name)
+    if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func Test_loadParamsFile_yaml(t *testing.T) {
+    path := writeParamsFile(t, "params.yaml", "name: my-service\nport: 8080\ndesc: \"a, b = c\"\nlicense: |\n  line1\n  line2\n")
+    defer os.RemoveAll(filepath.Dir(path))
+
+    params, err := loadParamsFile(path)
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    assertString(t, "Verify a string is read", "my-service", params["name"])
+    assertString(t, "Verify a number is read", "8080", params["port"])
+    assertString(t, "Verify commas and equals are kept", "a, b = c", params["desc"])
+    assertString(t, "Verify new lines are kept", "line1\nline2\n", params["license"])
+}
+
+func Test_loadParamsFile_json(t *testing.T) {
+    path := writeParamsFile(t, "params.json", `{"name": "my-service", "debug": true, "port": 10000000, "ratio": 0.5}`)
+    defer os.RemoveAll(filepath.Dir(path))
+
+    params, err := loadParamsFile(path)
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    assertString(t, "Verify a string is read", "my-service", params["name"])
+    assertString(t, "Verify a bool is read", "true", params["debug"])
+    assertString(t, "Verify a large integer is read as is", "10000000", params["port"])
+    assertString(t, "Verify a float is read", "0.5", params["ratio"])
+}
+
+func Test_scalarString(t *testing.T) {
+    assertString(t, "Verify a large float64 is not an exponent", "10000000", scalarString(float64(10000000)))
+    assertString(t, "Verify nil is empty", "", scalarString(nil))
+}
+
+func Test_loadParamsFile_toml(t *testing.T) {
+    path := writeParamsFile(t, "params.toml", "name = \"my-service\"\nport = 8080\n")
+    defer os.RemoveAll(filepath.Dir(path))
+
+    params, err := loadParamsFile(path)
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    assertString(t, "Verify a string is read", "my-service", params["name"])
+    assertString(t, "Verify a number is read", "8080", params["port"])
+}
+
+func Test_loadParamsFile_nested(t *testing.T) {
+    path := writeParamsFile(t, "params.json", `{"name": {"first": "a"}}`)
+    defer os.RemoveAll(filepath.Dir(path))
+
+    if _, err := loadParamsFile(path); err == nil {
+        t.Error("Verify a nested value is an error")
+    }
+}
+
+func Test_loadParamsFile_unknown(t *testing.T) {
+    path := writeParamsFile(t, "params.ini", "name=a")
+    defer os.RemoveAll(filepath.Dir(path))
+
+    if _, err := loadParamsFile(path); err == nil {
+        t.Error("Verify an unknown format is an error")
+    }
+}
+
+func Test_parseDotEnv(t *testing.T) {
+    params, err := parseDotEnv("# comment\nNAME=my-service\nexport DESC=\"a, b = c\\tx\"\nRAW='a\\nb'\nLICENSE=\"line1\nline2\" # comment\nEMPTY=\nTRAIL=value # comment\n")
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    assertString(t, "Verify a value is read", "my-service", params["NAME"])
+    assertString(t, "Verify a quoted value is unescaped", "a, b = c\tx", params["DESC"])
+    assertString(t, "Verify a single quoted value is kept", "a\\nb", params["RAW"])
+    assertString(t, "Verify a multi line value is read", "line1\nline2", params["LICENSE"])
+    assertString(t, "Verify an empty value is read", "", params["EMPTY"])
+    assertString(t, "Verify a comment is removed", "value", params["TRAIL"])
+}
+
+func Test_parseDotEnv_errors(t *testing.T) {
+    if _, err := parseDotEnv("NAME"); err == nil {
+        t.Error("Verify a line without = is an error")
+    }
+    if _, err := parseDotEnv("NAME=\"abc"); err == nil {
+        t.Error("Verify an unterminated value is an error")
+    }
+}
+
+func Test_envParams(t *testing.T) {
+    params := envParams("APP_", []string{"APP_NAME=my-service", "APP_=x", "HOME=/root", "APP_DESC=a=b"})
+    if len(params) != 2 {
+        t.Error("Verify only prefixed variables are read", params)
+    }
+    assertString(t, "Verify a prefix is removed", "my-service", params["NAME"])
+    assertString(t, "Verify a value with = is read", "a=b", params["DESC"])
+
+    if len(envParams("", []string{"HOME=/root"})) != 0 {
+        t.Error("Verify no variables are read without a prefix")
+    }
+}
+
+func Test_mergeParams(t *testing.T) {
+    merged := mergeParams(
+        map[string]string{"a": "file", "b": "file", "c": "file"},
+        map[string]string{"b": "env", "c": "env"},
+        map[string]string{"c": "flag"})
+    assertString(t, "Verify a file value is used", "file", merged["a"])
+    assertString(t, "Verify an env value overrides a file", "env", merged["b"])
+    assertString(t, "Verify a flag value overrides others", "flag", merged["c"])
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+type prompter struct {
+    reader *bufio.Reader
+    out io.Writer
+}
+
+func newPrompter(in io.Reader, out io.Writer) (p *prompter) {
+    p = new(prompter)
+    if in != nil {
+        p.reader = bufio.NewReader(in)
+    }
+    p.out = out
+    return
+}
+
+// readLine returns a trimmed line from the input. It returns io.EOF
+// when there is no more input.
+func (p *prompter) readLine() (string, error) {
+    if p.reader == nil {
+        return "", io.EOF
+    }
+    line, err := p.reader.ReadString('\n')
+    if err == io.EOF && len(line) > 0 {
+        err = nil
+    }
+    return strings.TrimSpace(line), err
+}
+
+// confirm asks a yes/no question. No input is handled as no.
+func (p *prompter) confirm(message string) (bool, error) {
+    fmt.Fprintf(p.out, "%s [y/N]: ", message)
+    answer, err := p.readLine()
+    if err == io.EOF {
+        fmt.Fprintln(p.out)
+        return false, nil
+    } else if err != nil {
+        return false, err
+    }
+    answer = strings.ToLower(answer)
+    return answer == "y" || answer == "yes", nil
+}
+
+// askParam asks a value of a template parameter until a valid value is
+// answered. ok is false when the parameter is left without a value.
+func (p *prompter) askParam(param *templateParam) (value string, ok bool, err error) {
+    defaultValue := ""
+    if param.Default != nil {
+        defaultValue = param.defaultString()
+    }
+
+    for {
+        fmt.Fprint(p.out, paramQuestion(param, defaultValue))
+        answer, err := p.readLine()
+        if err == io.EOF {
+            fmt.Fprintln(p.out)
+            return "", false, nil
+        } else if err != nil {
+            return "", false, err
+        }
+
+        if answer == "" {
+            if param.Default != nil {
+                return defaultValue, true, nil
+            }
+            if !param.Required {
+                return "", false, nil
+            }
+            fmt.Fprintln(p.out, "A value is required.")
+            continue
+        }
+
+        value = normalizeAnswer(param, answer)
+        if err = param.validate(value); err != nil {
+            fmt.Fprintln(p.out, "Invalid value:", err)
+            continue
+        }
+        return value, true, nil
+    }
+}
+
+func paramQuestion(param *templateParam, defaultValue string) string {
+    question := param.Name
+    if param.Description != "" {
+        question += " (" + param.Description + ")"
+    }
+
+    switch param.Type {
+    case ParamEnum:
+        for i, choice := range param.Choices {
+            question += fmt.Sprintf("\n  %d) %s", i + 1, choice)
+        }
+        question += "\nChoose"
+    case ParamBool:
+        question += " [y/n]"
+    }
+
+    if param.Default != nil {
+        question += " [" + defaultValue + "]"
+    }
+    return question + ": "
+}
+
+// normalizeAnswer converts an enum number and yes/no answers to a value.
+func normalizeAnswer(param *templateParam, answer string) string {
+    switch param.Type {
+    case ParamEnum:
+        if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(param.Choices) {
+            return param.Choices[i - 1]
+        }
+    case ParamBool:
+        switch strings.ToLower(answer) {
+        case "y", "yes":
+            return "true"
+        case "n", "no":
+            return "false"
+        }
+    }
+    return answer
+}
+
+// promptParams asks values of declared and discovered parameters which are
+// not given yet.
+func promptParams(p *prompter, schema *templateSchema, discovered []string, keywords map[string]string) (map[string]string, error) {
+    prompted := map[string]string{}
+    for key, value := range keywords {
+        prompted[key] = value
+    }
+
+    params := append([]*templateParam{}, schema.Params...)
+    for _, name := range discovered {
+        if !schema.hasParam(name) {
+            params = append(params, &templateParam{Name: name, Required: true})
+        }
+    }
+
+    for _, param := range params {
+        if _, ok := prompted[param.Name]; ok {
+            continue
+        }
+        value, ok, err := p.askParam(param)
+        if err != nil {
+            return nil, err
+        }
+        if ok {
+            prompted[param.Name] = value
+        }
+    }
+
+    return prompted, nil
+}
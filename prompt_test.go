@@ -0,0 +1,98 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func Test_prompter_confirm(t *testing.T) {
+    out := new(bytes.Buffer)
+    p := newPrompter(strings.NewReader("y\nno\n"), out)
+
+    yes, err := p.confirm("Overwrite?")
+    if !yes || err != nil {
+        t.Error("Verify y is handled as yes.")
+    }
+    yes, err = p.confirm("Overwrite?")
+    if yes || err != nil {
+        t.Error("Verify no is handled as no.")
+    }
+    yes, err = p.confirm("Overwrite?")
+    if yes || err != nil {
+        t.Error("Verify EOF is handled as no.")
+    }
+    if !strings.Contains(out.String(), "Overwrite? [y/N]: ") {
+        t.Error("Verify a question is written.", out.String())
+    }
+}
+
+func Test_prompter_confirm_noInput(t *testing.T) {
+    p := newPrompter(nil, new(bytes.Buffer))
+    yes, err := p.confirm("Overwrite?")
+    if yes || err != nil {
+        t.Error("Verify no input is handled as no.")
+    }
+}
+
+func Test_prompter_askParam_default(t *testing.T) {
+    out := new(bytes.Buffer)
+    p := newPrompter(strings.NewReader("\n"), out)
+    value, ok, err := p.askParam(&templateParam{Name: "port", Description: "listen port", Type: ParamInt, Default: 8080})
+    if !ok || err != nil {
+        t.Error("Verify a default is answered")
+    }
+    assertString(t, "Verify a default is used", "8080", value)
+    assertString(t, "Verify a question shows a description and a default", "port (listen port) [8080]: ", out.String())
+}
+
+func Test_prompter_askParam_enum(t *testing.T) {
+    out := new(bytes.Buffer)
+    p := newPrompter(strings.NewReader("sqlite\n2\n"), out)
+    value, ok, _ := p.askParam(&templateParam{Name: "db", Type: ParamEnum, Choices: []string{"mysql", "postgres"}})
+    if !ok {
+        t.Error("Verify a choice is answered")
+    }
+    assertString(t, "Verify a choice number is converted", "postgres", value)
+    if !strings.Contains(out.String(), "  1) mysql\n  2) postgres\n") {
+        t.Error("Verify choices are shown", out.String())
+    }
+    if !strings.Contains(out.String(), "Invalid value:") {
+        t.Error("Verify an invalid answer is asked again", out.String())
+    }
+}
+
+func Test_prompter_askParam_bool(t *testing.T) {
+    p := newPrompter(strings.NewReader("yes\n"), new(bytes.Buffer))
+    value, _, _ := p.askParam(&templateParam{Name: "docker", Type: ParamBool})
+    assertString(t, "Verify yes is converted", "true", value)
+}
+
+func Test_prompter_askParam_required(t *testing.T) {
+    p := newPrompter(strings.NewReader("\nfoo\n"), new(bytes.Buffer))
+    value, ok, _ := p.askParam(&templateParam{Name: "name", Required: true})
+    if !ok {
+        t.Error("Verify a required value is asked again")
+    }
+    assertString(t, "Verify an answer is returned", "foo", value)
+}
+
+func Test_prompter_askParam_EOF(t *testing.T) {
+    p := newPrompter(strings.NewReader(""), new(bytes.Buffer))
+    _, ok, err := p.askParam(&templateParam{Name: "name", Required: true})
+    if ok || err != nil {
+        t.Error("Verify no value is returned at EOF")
+    }
+}
+
+func Test_promptParams(t *testing.T) {
+    schema := &templateSchema{Params: []*templateParam{{Name: "name"}, {Name: "given"}}}
+    p := newPrompter(strings.NewReader("a\nb\n"), new(bytes.Buffer))
+    keywords, err := promptParams(p, schema, []string{"name", "found"}, map[string]string{"given": "x"})
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+    assertString(t, "Verify a declared parameter is asked", "a", keywords["name"])
+    assertString(t, "Verify a discovered parameter is asked", "b", keywords["found"])
+    assertString(t, "Verify a given parameter is kept", "x", keywords["given"])
+}
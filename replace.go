@@ -0,0 +1,110 @@
+package main
+
+import (
+    "io"
+    "strings"
+)
+
+// StreamReplaceFunc returns a reader which replaces keywords in contents
+// while they are read. It returns nil when contents of a file have to be
+// read fully and replaced by ReplaceFunc.
+type StreamReplaceFunc func(srcSubPath string, reader io.Reader) io.Reader
+
+// replaceChunkSize is the size to read contents at once.
+const replaceChunkSize = 32 * 1024
+
+// replaceReader replaces keywords chunk by chunk. The tail of a chunk which
+// can be the beginning of a keyword is kept until the next chunk is read,
+// so that the result is the same as newKeywordReplacer.
+type replaceReader struct {
+    reader io.Reader
+    keys [256][]string
+    values map[string]string
+    maxLen int
+    chunk []byte
+    in []byte
+    outBuf []byte
+    out []byte
+    err error
+}
+
+// newEngineStreamReplaceFunc returns StreamReplaceFunc for an engine.
+// Files rendered by text/template are not streamed.
+func newEngineStreamReplaceFunc(keywords map[string]string, engine string) StreamReplaceFunc {
+    return func (srcSubPath string, reader io.Reader) io.Reader {
+        if engine == EngineTemplate || strings.HasSuffix(srcSubPath, templateSuffix) {
+            return nil
+        }
+        return newReplaceReader(reader, keywords)
+    }
+}
+
+func newReplaceReader(reader io.Reader, keywords map[string]string) *replaceReader {
+    rr := new(replaceReader)
+    rr.reader = reader
+    rr.values = keywords
+    for _, key := range sortedKeywords(keywords) {
+        // Keys are ordered from the longest, so the first match is the longest.
+        rr.keys[key[0]] = append(rr.keys[key[0]], key)
+        if len(key) > rr.maxLen {
+            rr.maxLen = len(key)
+        }
+    }
+    rr.chunk = make([]byte, replaceChunkSize)
+    return rr
+}
+
+func (rr *replaceReader) Read(p []byte) (int, error) {
+    for len(rr.out) == 0 {
+        if rr.err != nil {
+            return 0, rr.err
+        }
+        rr.fill()
+    }
+
+    n := copy(p, rr.out)
+    rr.out = rr.out[n:]
+    return n, nil
+}
+
+// fill reads a next chunk and replaces keywords at positions where
+// enough bytes are read to decide the longest match.
+func (rr *replaceReader) fill() {
+    n, err := rr.reader.Read(rr.chunk)
+    rr.in = append(rr.in, rr.chunk[:n]...)
+    if err != nil {
+        rr.err = err
+    }
+
+    end := len(rr.in) - rr.maxLen + 1
+    if rr.err != nil || end > len(rr.in) {
+        end = len(rr.in)
+    }
+
+    out := rr.outBuf[:0]
+    i := 0
+    for i < end {
+        key := rr.match(rr.in[i:])
+        if key == "" {
+            out = append(out, rr.in[i])
+            i++
+            continue
+        }
+        out = append(out, rr.values[key]...)
+        i += len(key)
+    }
+
+    rr.in = append(rr.in[:0], rr.in[i:]...)
+    rr.outBuf = out
+    rr.out = out
+}
+
+// match returns the longest keyword at the beginning of in.
+func (rr *replaceReader) match(in []byte) string {
+    for _, key := range rr.keys[in[0]] {
+        if len(key) <= len(in) && string(in[:len(key)]) == key {
+            return key
+        }
+    }
+    return ""
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "io"
+    "io/ioutil"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "testing/iotest"
+)
+
+func readReplaced(t *testing.T, reader io.Reader, keywords map[string]string) string {
+    replaced, err := ioutil.ReadAll(newReplaceReader(reader, keywords))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(replaced)
+}
+
+func Test_replaceReader(t *testing.T) {
+    keywords := map[string]string{"app": "x", "appName": "y", "foo": "app"}
+    contents := "appName app foo appNam"
+    expected := newKeywordReplacer(keywords).Replace(contents)
+
+    assertString(t, "Verify contents are replaced", expected, readReplaced(t, strings.NewReader(contents), keywords))
+    assertString(t, "Verify one byte reads", expected, readReplaced(t, iotest.OneByteReader(strings.NewReader(contents)), keywords))
+    assertString(t, "Verify half reads", expected, readReplaced(t, iotest.HalfReader(strings.NewReader(contents)), keywords))
+}
+
+func Test_replaceReader_chunkBoundary(t *testing.T) {
+    keywords := map[string]string{"foo": "bar", "foobar": "baz"}
+    contents := strings.Repeat("a", replaceChunkSize - 2) + "foobar" + strings.Repeat("a", replaceChunkSize) + "foo"
+    expected := newKeywordReplacer(keywords).Replace(contents)
+
+    assertString(t, "Verify a keyword over chunks is replaced", expected, readReplaced(t, strings.NewReader(contents), keywords))
+}
+
+func Test_replaceReader_sameAsReplacer(t *testing.T) {
+    keywords := map[string]string{"a": "1", "ab": "2", "abc": "3", "bca": "4", "cc": ""}
+    random := rand.New(rand.NewSource(1))
+    for i := 0; i < 100; i++ {
+        buf := make([]byte, random.Intn(200))
+        for j := range buf {
+            buf[j] = "abc"[random.Intn(3)]
+        }
+        expected := newKeywordReplacer(keywords).Replace(string(buf))
+        actual := readReplaced(t, iotest.OneByteReader(strings.NewReader(string(buf))), keywords)
+        assertString(t, "Verify the same result as strings.Replacer for " + string(buf), expected, actual)
+    }
+}
+
+func Test_replaceReader_noKeywords(t *testing.T) {
+    assertString(t, "Verify contents are kept", "foo", readReplaced(t, strings.NewReader("foo"), map[string]string{}))
+}
+
+func Test_newEngineStreamReplaceFunc(t *testing.T) {
+    stream := newEngineStreamReplaceFunc(map[string]string{"foo": "bar"}, EngineLiteral)
+    if stream("a.txt.tmpl", strings.NewReader("foo")) != nil {
+        t.Error("Verify a template file is not streamed.")
+    }
+    replaced, _ := ioutil.ReadAll(stream("a.txt", strings.NewReader("foo")))
+    assertString(t, "Verify a file is streamed", "bar", string(replaced))
+
+    if newEngineStreamReplaceFunc(map[string]string{}, EngineTemplate)("a.txt", strings.NewReader("")) != nil {
+        t.Error("Verify the template engine is not streamed.")
+    }
+}
+
+func Test_copyEachFileSource_stream(t *testing.T) {
+    large := strings.Repeat("foo ", replaceChunkSize)
+    srcDir := newTemplateDir(t, map[string]string{"foo.txt": large, "foo.tmpl": "{{ .Params.foo }}"})
+    defer os.RemoveAll(srcDir)
+    destDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(destDir)
+
+    keywords := map[string]string{"foo": "bar"}
+    fileDA := newFileDestAccess(destDir, ConflictOverwrite, nil)
+    fileDA.report = func(action string, path string) {}
+    da := newBaselineDestAccess(fileDA, destDir)
+    err := copyEachFileSource(newFileAccess(srcDir), da, newTestFilter(t, "*", ""),
+        newEngineReplaceFunc(keywords, EngineLiteral), newEngineStreamReplaceFunc(keywords, EngineLiteral))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    contents, _ := ioutil.ReadFile(filepath.Join(destDir, "bar.txt"))
+    assertString(t, "Verify a large file is replaced", strings.Repeat("bar ", replaceChunkSize), string(contents))
+    contents, _ = ioutil.ReadFile(filepath.Join(destDir, "foo"))
+    assertString(t, "Verify a template file is rendered", "bar", string(contents))
+    if da.checksums["bar.txt"] != checksum([]byte(strings.Repeat("bar ", replaceChunkSize))) {
+        t.Error("Verify a checksum of a streamed file.", da.checksums)
+    }
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "gopkg.in/yaml.v2"
+    "io/ioutil"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// Parameter types of a template schema.
+const (
+    ParamString = "string"
+    ParamBool = "bool"
+    ParamInt = "int"
+    ParamEnum = "enum"
+)
+
+// schemaFileNames are the names of a template schema in the template root.
+// These files are not generated.
+var schemaFileNames = []string{"gokeleton.yaml", "gokeleton.yml", "gokeleton.json"}
+
+var errStopEachSource = errors.New("stop EachSource")
+
+// templateSchema declares parameters of a template, patterns of files
+// which are not generated(skip) or copied without replacement(raw), and
+// an engine used without --engine.
+type templateSchema struct {
+    Params []*templateParam `json:"params" yaml:"params"`
+    Skip []string `json:"skip" yaml:"skip"`
+    Raw []string `json:"raw" yaml:"raw"`
+    Engine string `json:"engine" yaml:"engine"`
+}
+
+type templateParam struct {
+    Name string `json:"name" yaml:"name"`
+    Description string `json:"description" yaml:"description"`
+    Type string `json:"type" yaml:"type"`
+    Default interface{} `json:"default" yaml:"default"`
+    Required bool `json:"required" yaml:"required"`
+    Pattern string `json:"pattern" yaml:"pattern"`
+    Choices []string `json:"choices" yaml:"choices"`
+}
+
+// loadSchema reads a template schema from sa. An empty schema is returned
+// when a template doesn't have it.
+func loadSchema(sa SourceAccess) (schema *templateSchema, err error) {
+    schema = new(templateSchema)
+
+    err = sa.EachSource(func(fileSource FileSource) error {
+        if fileSource.IsDir() || !isSchemaFile(fileSource.SubPath()) {
+            return nil
+        }
+
+        reader, err := fileSource.Reader()
+        if err != nil {
+            return err
+        }
+        defer reader.Close()
+
+        contents, err := ioutil.ReadAll(reader)
+        if err != nil {
+            return err
+        }
+
+        if strings.HasSuffix(fileSource.SubPath(), ".json") {
+            // A default number is kept as written instead of float64.
+            decoder := json.NewDecoder(bytes.NewReader(contents))
+            decoder.UseNumber()
+            err = decoder.Decode(schema)
+        } else {
+            err = yaml.Unmarshal(contents, schema)
+        }
+        if err != nil {
+            return fmt.Errorf("%s: %s", fileSource.SubPath(), err)
+        }
+        return errStopEachSource
+    })
+
+    if err == errStopEachSource {
+        err = nil
+    }
+    return
+}
+
+func isSchemaFile(subPath string) bool {
+    for _, name := range schemaFileNames {
+        if subPath == name {
+            return true
+        }
+    }
+    return false
+}
+
+// apply returns keywords which have default values of missing parameters.
+// All invalid parameters are reported to stderr.
+func (schema *templateSchema) apply(keywords map[string]string) (map[string]string, error) {
+    applied := map[string]string{}
+    for key, value := range keywords {
+        applied[key] = value
+    }
+
+    var errs []string
+    for _, param := range schema.Params {
+        value, ok := applied[param.Name]
+        if !ok && param.Default != nil {
+            value, ok = param.defaultString(), true
+            applied[param.Name] = value
+        }
+
+        var err error
+        if !ok {
+            if param.Required {
+                err = errors.New("required parameter is missing")
+            }
+        } else {
+            err = param.validate(value)
+        }
+
+        if err != nil {
+            message := fmt.Sprintf("parameter %s: %s", param.Name, err)
+            if param.Description != "" {
+                message += " (" + param.Description + ")"
+            }
+            fmt.Fprintln(os.Stderr, "Error:", message)
+            errs = append(errs, message)
+        }
+    }
+
+    if len(errs) > 0 {
+        return nil, errors.New(strings.Join(errs, "\n"))
+    }
+    return applied, nil
+}
+
+// engine returns an engine given by --engine, or an engine of the template
+// when it is empty. The literal engine is used when both are empty.
+func (schema *templateSchema) engine(flagEngine string) (string, error) {
+    if flagEngine != "" {
+        return flagEngine, nil
+    }
+    if schema.Engine == "" {
+        return EngineLiteral, nil
+    }
+    return schema.Engine, checkEngine(schema.Engine)
+}
+
+func (schema *templateSchema) hasParam(name string) bool {
+    for _, param := range schema.Params {
+        if param.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+func (param *templateParam) defaultString() string {
+    return scalarString(param.Default)
+}
+
+func (param *templateParam) validate(value string) error {
+    switch param.Type {
+    case "", ParamString:
+    case ParamBool:
+        if _, err := strconv.ParseBool(value); err != nil {
+            return fmt.Errorf("%q is not a bool", value)
+        }
+    case ParamInt:
+        if _, err := strconv.Atoi(value); err != nil {
+            return fmt.Errorf("%q is not an int", value)
+        }
+    case ParamEnum:
+        if !param.isChoice(value) {
+            return fmt.Errorf("%q is not one of %s", value, strings.Join(param.Choices, ", "))
+        }
+    default:
+        return fmt.Errorf("unknown type %s", param.Type)
+    }
+
+    if param.Pattern != "" {
+        re, err := regexp.Compile("^(?:" + param.Pattern + ")$")
+        if err != nil {
+            return err
+        }
+        if !re.MatchString(value) {
+            return fmt.Errorf("%q does not match %s", value, param.Pattern)
+        }
+    }
+
+    return nil
+}
+
+func (param *templateParam) isChoice(value string) bool {
+    for _, choice := range param.Choices {
+        if value == choice {
+            return true
+        }
+    }
+    return false
+}
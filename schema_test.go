@@ -0,0 +1,109 @@
+package main
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+func Test_loadSchema_yaml(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{
+        "gokeleton.yaml": "params:\n  - name: name\n    description: service name\n    required: true\n  - name: port\n    type: int\n    default: 8080\n",
+        "a.txt": "name"})
+    defer os.RemoveAll(srcDir)
+
+    schema, err := loadSchema(newFileAccess(srcDir))
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    if len(schema.Params) != 2 {
+        t.Fatal("Verify params are loaded", schema.Params)
+    }
+    assertString(t, "Verify description is loaded", "service name", schema.Params[0].Description)
+    assertString(t, "Verify default is loaded", "8080", schema.Params[1].defaultString())
+}
+
+func Test_loadSchema_json(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{
+        "gokeleton.json": `{"params": [{"name": "db", "type": "enum", "choices": ["mysql", "postgres"]}, {"name": "max", "type": "int", "default": 10000000}]}`})
+    defer os.RemoveAll(srcDir)
+
+    schema, err := loadSchema(newFileAccess(srcDir))
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    if len(schema.Params) != 2 || len(schema.Params[0].Choices) != 2 {
+        t.Fatal("Verify params are loaded", schema.Params)
+    }
+    assertString(t, "Verify a large default is not an exponent", "10000000", schema.Params[1].defaultString())
+}
+
+func Test_loadSchema_notFound(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{"a.txt": "a"})
+    defer os.RemoveAll(srcDir)
+
+    schema, err := loadSchema(newFileAccess(srcDir))
+    if err != nil || len(schema.Params) != 0 {
+        t.Error("Verify an empty schema is returned")
+    }
+}
+
+func Test_templateSchema_apply(t *testing.T) {
+    schema := &templateSchema{Params: []*templateParam{
+        {Name: "name", Required: true, Pattern: "[a-z-]+"},
+        {Name: "port", Type: ParamInt, Default: 8080},
+        {Name: "debug", Type: ParamBool, Default: false}}}
+
+    keywords, err := schema.apply(map[string]string{"name": "my-service", "port": "80"})
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    assertString(t, "Verify a value is kept", "80", keywords["port"])
+    assertString(t, "Verify a default is set", "false", keywords["debug"])
+}
+
+func Test_templateSchema_apply_errors(t *testing.T) {
+    schema := &templateSchema{Params: []*templateParam{
+        {Name: "name", Required: true},
+        {Name: "id", Pattern: "[a-z]+"},
+        {Name: "port", Type: ParamInt},
+        {Name: "debug", Type: ParamBool},
+        {Name: "db", Type: ParamEnum, Choices: []string{"mysql"}}}}
+
+    _, err := schema.apply(map[string]string{"id": "ABC", "port": "x", "debug": "maybe", "db": "postgres"})
+    if err == nil {
+        t.Fatal("Verify errors are returned")
+    }
+    for _, name := range []string{"name", "id", "port", "debug", "db"} {
+        if !strings.Contains(err.Error(), "parameter " + name + ":") {
+            t.Error("Verify an error of a parameter is reported: " + name, err)
+        }
+    }
+}
+
+func Test_copyEachFileSource_skipSchema(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{"gokeleton.yaml": "params: []", "a.txt": "a"})
+    defer os.RemoveAll(srcDir)
+
+    da := newDryRunDestAccess("/tmp/gokeleton-dest-not-found", ConflictFail)
+    copyEachFileSource(newFileAccess(srcDir), da, newTestFilter(t, "*", ""), newReplaceFunc(map[string]string{}), nil)
+    for _, entry := range da.entries {
+        if isSchemaFile(entry.subPath) {
+            t.Error("Verify a schema file is not generated")
+        }
+    }
+}
+
+func Test_templateSchema_engine(t *testing.T) {
+    schema := &templateSchema{Engine: EngineTemplate}
+    engine, _ := schema.engine(EngineLiteral)
+    assertString(t, "Verify --engine takes precedence", EngineLiteral, engine)
+    engine, _ = schema.engine("")
+    assertString(t, "Verify an engine of a template is used", EngineTemplate, engine)
+    engine, _ = new(templateSchema).engine("")
+    assertString(t, "Verify the literal engine is used by default", EngineLiteral, engine)
+
+    if _, err := (&templateSchema{Engine: "jinja"}).engine(""); err == nil {
+        t.Error("Verify an unknown engine of a template is an error.")
+    }
+}
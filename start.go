@@ -1,11 +1,16 @@
 package main
 
 import (
+    "bufio"
+    "errors"
     "fmt"
     "io"
     "io/ioutil"
+    "net/http"
     "os"
+    "path"
     "path/filepath"
+    "sort"
     "strings"
 )
 
@@ -15,6 +20,10 @@ type FileSource interface {
     SubPath() string
     IsDir() bool
     Reader() (io.ReadCloser, error)
+    // Mode returns permission bits and os.ModeSymlink for a symbolic link.
+    Mode() os.FileMode
+    // LinkTarget returns a target of a symbolic link.
+    LinkTarget() (string, error)
 }
 
 type FileSourceFunc func(fileSource FileSource) error
@@ -23,104 +32,451 @@ type SourceAccess interface {
     EachSource(callback FileSourceFunc) error
 }
 
+// SourceRevision is implemented by SourceAccess which can tell
+// which revision of a template is read by EachSource.
+type SourceRevision interface {
+    Revision() string
+    ArchiveHash() string
+}
+
+type DestAccess interface {
+    MakeDir(subPath string) error
+    WriteFile(subPath string, reader io.Reader, mode os.FileMode, replaced bool) error
+    Symlink(subPath string, target string) error
+}
+
 type StartParams struct {
-    Keywords string
+    Keywords []string
     KeySeparator string
     Arguments []string
     IncludeSuffixes string
     ExcludeSuffixes string
+    DryRun bool
+    OnConflict string
+    InStream io.Reader
+    Engine string
+    CaseVariants bool
+    Interactive bool
+    ParamsFile string
+    ParamsEnvPrefix string
+    SkipPatterns string
+    RawPatterns string
+    NoBinaryDetect bool
+    Jobs int
+    SourceType string
+    GithubAPIURL string
+    Ref string
+    TokenFile string
 }
 
 func StartMain(sp StartParams) error {
     srcPath := sp.Arguments[0]
     destPath := sp.Arguments[1]
-    keyMap := stringsToMap(sp.Keywords, sp.KeySeparator)
     includeSuffixes := toList(sp.IncludeSuffixes, sp.KeySeparator)
     excludeSuffixes := toList(sp.ExcludeSuffixes, sp.KeySeparator)
 
-    _, err := os.Stat(destPath)
-    if os.IsNotExist(err) {
-        sa := newSourceAccess(srcPath)
-        return copyEachFileSource(sa, destPath, includeSuffixes, excludeSuffixes, newReplaceFunc(keyMap))
-    } else if err != nil {
+    onConflict := sp.OnConflict
+    if onConflict == "" {
+        onConflict = ConflictFail
+    }
+
+    // An empty engine is decided by a template later.
+    engine := sp.Engine
+
+    err := checkConflictPolicy(onConflict)
+    if err == nil && engine != "" {
+        err = checkEngine(engine)
+    }
+    if err == nil {
+        err = checkSourceType(sp.SourceType)
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+
+    fileParams := map[string]string{}
+    if sp.ParamsFile != "" {
+        fileParams, err = loadParamsFile(sp.ParamsFile)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Error:", err)
+            return err
+        }
+    }
+    flagParams, err := paramsToMap(sp.Keywords, sp.KeySeparator)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+    keyMap := mergeParams(fileParams, envParams(sp.ParamsEnvPrefix, os.Environ()), flagParams)
+
+    sa := newSourceAccess(srcPath, &sourceConfig{sourceType: sp.SourceType, githubAPIURL: sp.GithubAPIURL, ref: sp.Ref, tokenFile: sp.TokenFile})
+    if closer, ok := sa.(io.Closer); ok {
+        defer closer.Close()
+    }
+    schema, err := loadSchema(sa)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+    engine, err = schema.engine(engine)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+
+    p := newPrompter(sp.InStream, os.Stderr)
+    if sp.Interactive {
+        keyMap, err = promptMissingParams(p, sa, schema, engine, keyMap)
+        if err != nil {
+            return err
+        }
+    }
+
+    keyMap, err = schema.apply(keyMap)
+    if err != nil {
         return err
+    }
+
+    skipPatterns := toList(sp.SkipPatterns, sp.KeySeparator)
+    rawPatterns := toList(sp.RawPatterns, sp.KeySeparator)
+    filter, err := newSourceFilter(includeSuffixes, excludeSuffixes,
+        append(skipPatterns, schema.Skip...), append(rawPatterns, schema.Raw...))
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+    filter.noBinaryDetect = sp.NoBinaryDetect
+    _, isLocal := sa.(*fileAccess)
+    filter.localLinks = !isLocal
+
+    replaceKeys := keyMap
+    if sp.CaseVariants {
+        replaceKeys = expandCaseVariants(keyMap)
+    }
+    handler := newEngineReplaceFunc(replaceKeys, engine)
+    stream := newEngineStreamReplaceFunc(replaceKeys, engine)
+
+    jobs := sp.Jobs
+    if onConflict == ConflictPrompt {
+        // Prompts for existing files cannot be answered in parallel.
+        jobs = 1
+    }
+
+    if sp.DryRun {
+        da := newDryRunDestAccess(destPath, onConflict)
+        err = copyEachFileSourceParallel(sa, da, filter, handler, stream, jobs)
+        if err == nil {
+            da.report(os.Stdout)
+        }
+        if err == nil && da.hasConflict() {
+            fmt.Fprintln(os.Stderr, "Error: some files already exist. Use --on-conflict to generate them.")
+            err = errDryRunConflict
+        }
+        return err
+    }
+
+    m := &manifest{
+        Source: manifestSource(srcPath),
+        Keywords: keyMap,
+        Includes: includeSuffixes,
+        Excludes: excludeSuffixes,
+        Skips: skipPatterns,
+        Raws: rawPatterns,
+        NoBinaryDetect: sp.NoBinaryDetect,
+        SourceType: sp.SourceType,
+        Ref: sp.Ref,
+        Engine: engine,
+        CaseVariants: sp.CaseVariants}
+
+    fileDA := newFileDestAccess(destPath, onConflict, p)
+    generate := func() error {
+        da := newBaselineDestAccess(fileDA, fileDA.destPath)
+        da.baseline.journal = fileDA.journal
+        err := copyEachFileSourceParallel(sa, da, filter, handler, stream, jobs)
+        if err != nil || !da.isRecorded() {
+            return err
+        }
+
+        m.setGenerated(sa, da)
+        return writeJournaledManifest(fileDA.destPath, m, fileDA.journal)
+    }
+
+    if _, err = os.Lstat(destPath); err == nil {
+        err = generateWithJournal(fileDA, generate)
     } else {
-        fmt.Fprintln(os.Stderr, "Error: dest path:", destPath, " already exists")
-        return os.ErrExist
+        err = generateAtomically(fileDA, generate)
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
     }
+    return err
 }
 
-func newSourceAccess(srcPath string) SourceAccess {
-    if strings.Index(srcPath, "http://") == 0 || strings.Index(srcPath, "https://") == 0 {
-        return newGithubAccess(srcPath)
-    } else {
+func promptMissingParams(p *prompter, sa SourceAccess, schema *templateSchema, engine string, keyMap map[string]string) (map[string]string, error) {
+    discovered, err := findTemplateParams(sa, engine)
+    if err != nil {
+        return nil, err
+    }
+    return promptParams(p, schema, discovered, keyMap)
+}
+
+// Source types select how a template is read.
+const (
+    SourceGithub = "github"
+    SourceGitlab = "gitlab"
+    SourceBitbucket = "bitbucket"
+    SourceGit = "git"
+    SourceArchive = "archive"
+    SourceFile = "file"
+)
+
+func checkSourceType(sourceType string) error {
+    switch sourceType {
+    case "", SourceGithub, SourceGitlab, SourceBitbucket, SourceGit, SourceArchive, SourceFile:
+        return nil
+    }
+    return errors.New("Unknown source type: " + sourceType)
+}
+
+// sourceConfig configures how templates are downloaded.
+type sourceConfig struct {
+    // sourceType is one of Source* constants. A type is detected from
+    // a source when it is empty.
+    sourceType string
+    // githubAPIURL is the base URL of GitHub API. The host of the URL is
+    // accepted as a GitHub Enterprise host.
+    githubAPIURL string
+    // ref is a branch, a tag or a commit to download. It takes precedence
+    // over a ref in a URL.
+    ref string
+    // tokenFile is a file which has a token for private templates.
+    tokenFile string
+    // httpClient is used for APIs and downloads. http.DefaultClient is used
+    // when it is nil.
+    httpClient *http.Client
+}
+
+func newSourceAccess(srcPath string, config *sourceConfig) SourceAccess {
+    switch detectSourceType(srcPath, config) {
+    case SourceGithub:
+        return newGithubAccess(srcPath, config)
+    case SourceGitlab:
+        return newHostedAccess(srcPath, new(gitlabService), config)
+    case SourceBitbucket:
+        return newHostedAccess(srcPath, new(bitbucketService), config)
+    case SourceGit:
+        return newGitAccess(srcPath, config)
+    case SourceArchive:
+        return newArchiveAccess(srcPath, config)
+    default:
         return newFileAccess(srcPath)
     }
 }
 
-func copyEachFileSource(sa SourceAccess, destPath string, includeSuffixes []string, excludeSuffixes []string, handler ReplaceFunc) error {
+// detectSourceType returns a configured source type or a type detected from
+// srcPath. A URL of an unknown host is read by git.
+func detectSourceType(srcPath string, config *sourceConfig) string {
+    if config != nil && config.sourceType != "" {
+        return config.sourceType
+    }
+    if isGitSource(srcPath) {
+        return SourceGit
+    }
+    if isArchiveSource(srcPath) {
+        return SourceArchive
+    }
+    if !isHTTPSource(srcPath) {
+        return SourceFile
+    }
+    if isGithubURL(srcPath, config) {
+        return SourceGithub
+    }
+    if sourceType := hostedSourceType(srcPath); sourceType != "" {
+        return sourceType
+    }
+    return SourceGit
+}
+
+// sourceFilter decides how each file source is generated. Skipped files are
+// not generated. Raw files are copied without replacing contents.
+type sourceFilter struct {
+    includes *pathMatcher
+    excludes *pathMatcher
+    skips *pathMatcher
+    raws *pathMatcher
+    // noBinaryDetect disables copying binary files verbatim.
+    noBinaryDetect bool
+    // localLinks refuses link targets out of a dest path. It is set for
+    // remote and archive sources.
+    localLinks bool
+}
+
+func newSourceFilter(includes []string, excludes []string, skips []string, raws []string) (f *sourceFilter, err error) {
+    f = new(sourceFilter)
+    if f.includes, err = newPathMatcher(includes); err != nil {
+        return nil, err
+    }
+    if f.excludes, err = newPathMatcher(excludes); err != nil {
+        return nil, err
+    }
+    if f.skips, err = newPathMatcher(skips); err != nil {
+        return nil, err
+    }
+    f.raws, err = newPathMatcher(raws)
+    return
+}
+
+func (f *sourceFilter) isSkipped(subPath string) bool {
+    return subPath != "" && f.skips.match(subPath)
+}
+
+func (f *sourceFilter) isRaw(subPath string) bool {
+    return f.raws.match(subPath) || !f.includes.match(subPath) || f.excludes.match(subPath)
+}
+
+// isRawDir returns true when all files under a directory are raw.
+func (f *sourceFilter) isRawDir(subPath string) bool {
+    return subPath != "" && (f.raws.matchDir(subPath) || f.excludes.matchDir(subPath))
+}
+
+// copyEachFileSource generates each file source into da. Contents are
+// streamed through stream if it returns a reader, otherwise they are read
+// fully and replaced by handler.
+func copyEachFileSource(sa SourceAccess, da DestAccess, filter *sourceFilter, handler ReplaceFunc, stream StreamReplaceFunc) error {
+    return walkFileSources(sa, da, filter, handler, func(fileSource FileSource, raw bool) error {
+        return copyFileSource(fileSource, raw, da, filter, handler, stream)
+    })
+}
+
+// walkFileSources creates directories and symbolic links in da and calls
+// fileFunc for each file to be generated. raw is true when a file is copied
+// without replacing contents by patterns.
+func walkFileSources(sa SourceAccess, da DestAccess, filter *sourceFilter, handler ReplaceFunc, fileFunc func(fileSource FileSource, raw bool) error) error {
+    // Files under these directories are raw without checking patterns.
+    var rawDirs []string
+
     return sa.EachSource(func(fileSource FileSource) error {
-        var isDestDir bool
-        var contentBytes []byte
-        var subPath, contents string
+        srcSubPath := fileSource.SubPath()
+
+        if isSchemaFile(srcSubPath) {
+            return nil
+        }
+
+        if filter.isSkipped(srcSubPath) {
+            if fileSource.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+
+        if fileSource.Mode() & os.ModeSymlink != 0 {
+            return copySymlink(fileSource, da, filter, handler)
+        }
 
         if fileSource.IsDir() {
-            subPath, _, err := handler(fileSource.SubPath(), "")
+            if !isUnderDirs(rawDirs, srcSubPath) && filter.isRawDir(srcSubPath) {
+                rawDirs = append(rawDirs, normalizePath(srcSubPath, true))
+            }
+
+            subPath, _, err := handler(srcSubPath, "")
             if err != nil {
                 return err
             }
-            return os.MkdirAll(normalizePath(destPath, true) + subPath, 0777)
+            return da.MakeDir(subPath)
         }
 
-        reader, err := fileSource.Reader()
-        if err != nil {
-            return err
-        }
-        defer reader.Close()
+        return fileFunc(fileSource, isUnderDirs(rawDirs, srcSubPath) || filter.isRaw(srcSubPath))
+    })
+}
+
+// copyFileSource generates a file. Binary files are copied as raw files
+// unless the detection is disabled.
+func copyFileSource(fileSource FileSource, raw bool, da DestAccess, filter *sourceFilter, handler ReplaceFunc, stream StreamReplaceFunc) error {
+    var subPath, contents string
+    srcSubPath := fileSource.SubPath()
+
+    reader, err := fileSource.Reader()
+    if err != nil {
+        return err
+    }
+    defer reader.Close()
+
+    buffered := bufio.NewReaderSize(reader, binarySniffLen)
+    head, err := buffered.Peek(binarySniffLen)
+    if err != nil && err != io.EOF {
+        return err
+    }
 
-        contentBytes, err = ioutil.ReadAll(reader)
+    if raw || (!filter.noBinaryDetect && isBinary(head)) {
+        // Only a path is replaced to be generated in a replaced directory.
+        subPath, _, err = handler(srcSubPath, "")
         if err != nil {
             return err
         }
+        return da.WriteFile(subPath, buffered, fileSource.Mode(), false)
+    }
 
-        if isMatchSuffixes(includeSuffixes, fileSource.SubPath()) &&
-          !isMatchSuffixes(excludeSuffixes, fileSource.SubPath()) {
-            subPath, contents, err = handler(fileSource.SubPath(), string(contentBytes))
+    if stream != nil {
+        if replaced := stream(srcSubPath, buffered); replaced != nil {
+            subPath, _, err = handler(srcSubPath, "")
             if err != nil {
                 return err
             }
-            contentBytes = nil
-        } else {
-            subPath = fileSource.SubPath()
+            return da.WriteFile(subPath, replaced, fileSource.Mode(), true)
         }
+    }
 
-        // This is expected to be created before calling here.
-        // Or, ignore error for a dest file is used.
-        isDestDir, err = isDirectory(destPath)
-
-        newFilePath := normalizePath(destPath, isDestDir) + subPath
-        out, outErr := os.Create(newFilePath)
-        if outErr != nil {
-            return outErr
-        }
+    contentBytes, err := ioutil.ReadAll(buffered)
+    if err != nil {
+        return err
+    }
 
-        if contentBytes != nil {
-            _, err = out.Write(contentBytes)
-        } else {
-            _, err = out.WriteString(contents)
-        }
+    subPath, contents, err = handler(srcSubPath, string(contentBytes))
+    if err != nil {
+        return err
+    }
+    return da.WriteFile(subPath, strings.NewReader(contents), fileSource.Mode(), true)
+}
 
-        if err == nil {
-            fmt.Println("Create", newFilePath)
-        }
+// copySymlink creates a symbolic link. Keywords in a link target are
+// replaced as well as a path.
+func copySymlink(fileSource FileSource, da DestAccess, filter *sourceFilter, handler ReplaceFunc) error {
+    target, err := fileSource.LinkTarget()
+    if err != nil {
+        return err
+    }
 
+    subPath, _, err := handler(fileSource.SubPath(), "")
+    if err != nil {
         return err
-    })
+    }
+    target, _, err = handler(target, "")
+    if err != nil {
+        return err
+    }
+    if filter.localLinks && !isLocalLink(subPath, target) {
+        return errors.New("Refuse a symbolic link out of a dest path: " + subPath + " -> " + target)
+    }
+    return da.Symlink(subPath, target)
+}
+
+// isLocalLink returns true when a link at subPath to target stays in
+// a dest path.
+func isLocalLink(subPath string, target string) bool {
+    target = filepath.ToSlash(target)
+    if path.IsAbs(target) || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+        return false
+    }
+    linked := path.Join(path.Dir(filepath.ToSlash(subPath)), target)
+    return linked != ".." && !strings.HasPrefix(linked, "../")
 }
 
-func isMatchSuffixes(suffixes []string, name string) bool {
-    for _, suffix := range suffixes {
-        if suffix == "*" || strings.HasSuffix(name, suffix) {
+// isUnderDirs returns true when name is under one of dirs.
+// Each of dirs should end with a separator.
+func isUnderDirs(dirs []string, name string) bool {
+    for _, dir := range dirs {
+        if strings.HasPrefix(name, dir) {
             return true
         }
     }
@@ -128,20 +484,47 @@ func isMatchSuffixes(suffixes []string, name string) bool {
 }
 
 func newReplaceFunc(keywords map[string]string) ReplaceFunc {
-    return func (srcSubPath string, srcContents string) (subPath string, contents string, err error) {
-        subPath = srcSubPath
-        contents = srcContents
-
-        for key, val := range keywords {
-            subPath = strings.Replace(subPath, key, val, -1)
-            contents = strings.Replace(contents, key, val, -1)
-        }
+    replacer := newKeywordReplacer(keywords)
 
+    return func (srcSubPath string, srcContents string) (subPath string, contents string, err error) {
+        subPath = replacer.Replace(srcSubPath)
+        contents = replacer.Replace(srcContents)
         err = nil
         return
     }
 }
 
+// newKeywordReplacer returns a replacer which replaces keywords in one pass.
+// When keywords overlap at a position, the longest one is replaced.
+// Replaced text is not scanned again.
+func newKeywordReplacer(keywords map[string]string) *strings.Replacer {
+    keys := sortedKeywords(keywords)
+    oldnew := make([]string, 0, len(keys) * 2)
+    for _, key := range keys {
+        oldnew = append(oldnew, key, keywords[key])
+    }
+    return strings.NewReplacer(oldnew...)
+}
+
+// sortedKeywords returns non empty keywords ordered from the longest.
+// strings.Replacer prefers a former keyword when some keywords match
+// at the same position.
+func sortedKeywords(keywords map[string]string) []string {
+    keys := make([]string, 0, len(keywords))
+    for key := range keywords {
+        if key != "" {
+            keys = append(keys, key)
+        }
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if len(keys[i]) != len(keys[j]) {
+            return len(keys[i]) > len(keys[j])
+        }
+        return keys[i] < keys[j]
+    })
+    return keys
+}
+
 func toSubPath(basePath string, fullPath string) string {
     return fullPath[len(basePath):]
 }
@@ -166,29 +549,107 @@ func isDirectory(path string) (isDir bool, err error) {
     return fInfo.IsDir(), nil
 }
 
-func stringsToMap(keywords string, sep string) (keyMap map[string]string) {
-    var key, value string
+// stringsToMap parses key=value pairs separated by sep. A value can be quoted
+// by "..." or '...', and a backslash escapes the next character, so that
+// values can have sep and =. A pair without = is an error.
+func stringsToMap(keywords string, sep string) (keyMap map[string]string, err error) {
     keyMap = map[string]string{}
 
-    if len(keywords) == 0 {
-        return
+    pairs, err := splitPairs(keywords, sep)
+    if err != nil {
+        return nil, err
     }
 
-    pairs := strings.Split(keywords, sep)
+    for _, pair := range pairs {
+        if pair.index < 0 {
+            return nil, fmt.Errorf("parameter %q: expected key=value", pair.raw)
+        }
+        key := strings.TrimSpace(pair.text[:pair.index])
+        if key == "" {
+            return nil, fmt.Errorf("parameter %q: key is empty", pair.raw)
+        }
+        keyMap[key] = pair.text[pair.index:]
+    }
+
+    return
+}
+
+// paramsToMap parses each of params by stringsToMap. Latter params take
+// precedence.
+func paramsToMap(params []string, sep string) (keyMap map[string]string, err error) {
+    keyMap = map[string]string{}
+    for _, p := range params {
+        var m map[string]string
+        m, err = stringsToMap(p, sep)
+        if err != nil {
+            return nil, err
+        }
+        keyMap = mergeParams(keyMap, m)
+    }
+    return
+}
+
+type keywordPair struct {
+    raw string
+    // text is an unquoted and unescaped pair
+    text string
+    // index is the position of an unquoted = in text. -1 means no =.
+    index int
+}
+
+func splitPairs(keywords string, sep string) (pairs []keywordPair, err error) {
+    var quote byte
+    var text []byte
+    start := 0
+    index := -1
 
-    for _, kv := range pairs {
-        index := strings.IndexByte(kv, '=')
-        if index >= 0 {
-            key = kv[0:index]
-            value = kv[index + 1:]
-        } else {
-            key = kv
-            value = ""
+    addPair := func(end int) {
+        raw := keywords[start:end]
+        if strings.TrimSpace(raw) != "" {
+            pairs = append(pairs, keywordPair{raw: raw, text: string(text), index: index})
         }
+        text = nil
+        index = -1
+    }
 
-        keyMap[key] = value
+    for i := 0; i < len(keywords); i++ {
+        c := keywords[i]
+        switch {
+        case quote == '\'':
+            if c == quote {
+                quote = 0
+            } else {
+                text = append(text, c)
+            }
+        case c == '\\':
+            if i + 1 == len(keywords) {
+                return nil, fmt.Errorf("parameter %q: trailing backslash", keywords[start:])
+            }
+            i++
+            text = append(text, keywords[i])
+        case quote == '"':
+            if c == quote {
+                quote = 0
+            } else {
+                text = append(text, c)
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == '=' && index < 0:
+            index = len(text)
+        case len(sep) > 0 && strings.HasPrefix(keywords[i:], sep):
+            addPair(i)
+            i += len(sep) - 1
+            start = i + 1
+        default:
+            text = append(text, c)
+        }
     }
 
+    if quote != 0 {
+        return nil, fmt.Errorf("parameter %q: unterminated quote", keywords[start:])
+    }
+    addPair(len(keywords))
     return
 }
 
@@ -15,32 +15,32 @@ func assertString(t *testing.T, desc string, expected string, result string) {
 }
 
 func Test_stringsToMap_Nothing(t *testing.T) {
-    m := stringsToMap("", ",")
-    if len(m) != 0 {
+    m, err := stringsToMap("", ",")
+    if len(m) != 0 || err != nil {
         t.Error("Verify no map key-value found.")
     }
 }
 
 func Test_stringsToMap_Simple(t *testing.T) {
-    m := stringsToMap("foo=bar", ",")
+    m, _ := stringsToMap("foo=bar", ",")
     if m["foo"] != "bar" {
         t.Error("Verify there is a key value pair.")
     }
 }
 
 func Test_stringsToMap_KeyOnly(t *testing.T) {
-    m := stringsToMap("foo", ",")
-    if m["foo"] != "" {
-        t.Error("Verify no value is set")
+    _, err := stringsToMap("foo", ",")
+    if err == nil {
+        t.Error("Verify a key without a value is an error")
     }
-    m = stringsToMap("foo=", ",")
-    if m["foo"] != "" {
+    m, err := stringsToMap("foo=", ",")
+    if m["foo"] != "" || err != nil {
         t.Error("Verify no value is set")
     }
 }
 
 func Test_stringsToMap_MultiKeywords(t *testing.T) {
-    m := stringsToMap("foo=bar,bar=hoge", ",")
+    m, _ := stringsToMap("foo=bar,bar=hoge", ",")
 
     if len(m) != 2 {
         t.Error("Verify there are two entries.")
@@ -55,35 +55,53 @@ func Test_stringsToMap_MultiKeywords(t *testing.T) {
     }
 }
 
-func Test_newSourceAccess_URL(t *testing.T) {
-    sa := newSourceAccess("https://github.com/hata/gorep")
-    if sa == nil {
-        t.Error("Verify https protocol should return SourceAccess for github")
+func Test_stringsToMap_Quoted(t *testing.T) {
+    m, err := stringsToMap(`desc="a, b = c",name='x,"y"',foo=bar`, ",")
+    if err != nil {
+        t.Error("Verify no error found", err)
     }
+    assertString(t, "Verify a double quoted value is read", "a, b = c", m["desc"])
+    assertString(t, "Verify a single quoted value is read", `x,"y"`, m["name"])
+    assertString(t, "Verify a following pair is read", "bar", m["foo"])
 }
 
-func Test_newSourceAccess_File(t *testing.T) {
-    sa := newSourceAccess("/tmp")
-    if sa == nil {
-        t.Error("Verify a local file should return SourceAccess for github")
+func Test_stringsToMap_Escaped(t *testing.T) {
+    m, err := stringsToMap(`a\=b=c\,d\\,e=f`, ",")
+    if err != nil {
+        t.Error("Verify no error found", err)
     }
+    assertString(t, "Verify escaped = and separator are read", `c,d\`, m["a=b"])
+    assertString(t, "Verify a following pair is read", "f", m["e"])
 }
 
-func Test_isMatchSuffixes_matched(t *testing.T) {
-    if !isMatchSuffixes([]string{".foo", ".txt"}, "/tmp/test.txt") {
-        t.Error("Verify .txt should be matched.")
+func Test_stringsToMap_Malformed(t *testing.T) {
+    for _, keywords := range []string{"=bar", `foo="bar`, `foo=bar\`, "foo=bar,name"} {
+        if _, err := stringsToMap(keywords, ","); err == nil {
+            t.Error("Verify malformed parameters are an error: " + keywords)
+        }
     }
 }
 
-func Test_isMatchSuffixes_unmatched(t *testing.T) {
-    if isMatchSuffixes([]string{".foo"}, "/tmp/test.txt") {
-        t.Error("Verify unmatched suffix")
+func Test_paramsToMap(t *testing.T) {
+    m, err := paramsToMap([]string{"foo=bar,a=b", "foo=hoge"}, ",")
+    if err != nil {
+        t.Error("Verify no error found", err)
     }
+    assertString(t, "Verify a latter param takes precedence", "hoge", m["foo"])
+    assertString(t, "Verify params are accumulated", "b", m["a"])
 }
 
-func Test_isMatchSuffixes_wildcard(t *testing.T) {
-    if !isMatchSuffixes([]string{"*"}, "/tmp/test.txt") {
-        t.Error("Verify wildcard match everything")
+func Test_newSourceAccess_URL(t *testing.T) {
+    sa := newSourceAccess("https://github.com/hata/gorep", nil)
+    if sa == nil {
+        t.Error("Verify https protocol should return SourceAccess for github")
+    }
+}
+
+func Test_newSourceAccess_File(t *testing.T) {
+    sa := newSourceAccess("/tmp", nil)
+    if sa == nil {
+        t.Error("Verify a local file should return SourceAccess for github")
     }
 }
 
@@ -180,3 +198,45 @@ func Test_toList_Space(t *testing.T) {
         t.Error("Verify list is separated correctly")
     }
 }
+
+func Test_newReplaceFunc_longestMatch(t *testing.T) {
+    rf := newReplaceFunc(map[string]string{"app": "x", "appName": "y", "appNameLong": "z"})
+    _, contents, _ := rf("", "app appName appNameLong appNam")
+    assertString(t, "Verify the longest keyword is replaced", "x y z xNam", contents)
+}
+
+func Test_newReplaceFunc_noRescan(t *testing.T) {
+    rf := newReplaceFunc(map[string]string{"foo": "bar", "bar": "baz"})
+    subPath, contents, _ := rf("foo/bar", "foo,bar")
+    assertString(t, "Verify replaced path is not replaced again", "bar/baz", subPath)
+    assertString(t, "Verify replaced contents are not replaced again", "bar,baz", contents)
+}
+
+func Test_newReplaceFunc_stable(t *testing.T) {
+    keywords := map[string]string{"a": "b", "b": "c", "ab": "d", "abc": "e", "c": "a", "bc": "f"}
+    _, expected, _ := newReplaceFunc(keywords)("", "abcabcbcaab")
+    for i := 0; i < 100; i++ {
+        _, contents, _ := newReplaceFunc(keywords)("", "abcabcbcaab")
+        if contents != expected {
+            t.Fatal("Verify replacement is stable", expected, contents)
+        }
+    }
+    assertString(t, "Verify replaced result", "eefbd", expected)
+}
+
+func Test_newReplaceFunc_emptyKey(t *testing.T) {
+    rf := newReplaceFunc(map[string]string{"": "x"})
+    _, contents, _ := rf("", "abc")
+    assertString(t, "Verify an empty keyword is ignored", "abc", contents)
+}
+
+func Test_isLocalLink(t *testing.T) {
+    if !isLocalLink("a/link", "../b.txt") || !isLocalLink("link", "a/b.txt") {
+        t.Error("Verify a link in a dest path is local.")
+    }
+    for _, target := range []string{"../x", "a/../../x", "/etc/passwd"} {
+        if isLocalLink("link", target) {
+            t.Error("Verify a link out of a dest path is not local.", target)
+        }
+    }
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "io/ioutil"
+    "regexp"
+    "sort"
+    "strings"
+    "text/template"
+)
+
+// Engines render keywords in template files.
+const (
+    EngineLiteral = "literal"
+    EngineTemplate = "template"
+)
+
+// Files which have this suffix are rendered by text/template
+// in any engine. The suffix is removed from a generated file.
+const templateSuffix = ".tmpl"
+
+// templateParamPattern finds parameters referred in templates
+// like {{ .Params.name }} or {{ index .Params "app-name" }}.
+var templateParamPattern = regexp.MustCompile(`\.Params\.([A-Za-z_][A-Za-z0-9_]*)|index\s+\.Params\s+"([^"]+)"`)
+
+type templateData struct {
+    Params map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+    "upper": strings.ToUpper,
+    "lower": strings.ToLower,
+    "title": strings.Title,
+    "trim": strings.TrimSpace,
+    "replace": func(old string, new string, s string) string {
+        return strings.Replace(s, old, new, -1)
+    },
+    "contains": func(substr string, s string) bool {
+        return strings.Contains(s, substr)
+    },
+    "hasPrefix": func(prefix string, s string) bool {
+        return strings.HasPrefix(s, prefix)
+    },
+    "hasSuffix": func(suffix string, s string) bool {
+        return strings.HasSuffix(s, suffix)
+    },
+    "split": func(sep string, s string) []string {
+        return strings.Split(s, sep)
+    },
+    "join": func(sep string, elems []string) string {
+        return strings.Join(elems, sep)
+    },
+    "camel": func(s string) string {
+        return toCamelCase(splitWords(s))
+    },
+    "pascal": func(s string) string {
+        return toPascalCase(splitWords(s))
+    },
+    "snake": func(s string) string {
+        return toSnakeCase(splitWords(s))
+    },
+    "upperSnake": func(s string) string {
+        return toUpperSnakeCase(splitWords(s))
+    },
+    "kebab": func(s string) string {
+        return toKebabCase(splitWords(s))
+    },
+    "default": func(defaultValue string, value string) string {
+        if value == "" {
+            return defaultValue
+        }
+        return value
+    },
+}
+
+func checkEngine(engine string) error {
+    switch engine {
+    case EngineLiteral, EngineTemplate:
+        return nil
+    }
+    return errors.New("Unknown engine: " + engine)
+}
+
+// newEngineReplaceFunc returns ReplaceFunc for an engine. In the literal
+// engine, only *.tmpl files are rendered by text/template.
+func newEngineReplaceFunc(keywords map[string]string, engine string) ReplaceFunc {
+    literal := newReplaceFunc(keywords)
+    data := &templateData{Params: keywords}
+
+    return func (srcSubPath string, srcContents string) (subPath string, contents string, err error) {
+        if engine != EngineTemplate && !strings.HasSuffix(srcSubPath, templateSuffix) {
+            return literal(srcSubPath, srcContents)
+        }
+
+        subPath, err = renderTemplate(srcSubPath, srcSubPath, data)
+        if err != nil {
+            return
+        }
+        subPath = strings.TrimSuffix(subPath, templateSuffix)
+
+        contents, err = renderTemplate(srcSubPath, srcContents, data)
+        return
+    }
+}
+
+func renderTemplate(name string, text string, data *templateData) (string, error) {
+    if !strings.Contains(text, "{{") {
+        return text, nil
+    }
+
+    tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+    if err != nil {
+        return "", err
+    }
+
+    buf := new(bytes.Buffer)
+    err = tmpl.Execute(buf, data)
+    if err != nil {
+        return "", err
+    }
+    return buf.String(), nil
+}
+
+// findTemplateParams returns parameters referred in files and paths
+// rendered by text/template.
+func findTemplateParams(sa SourceAccess, engine string) (names []string, err error) {
+    found := map[string]bool{}
+    addParams := func(text string) {
+        for _, match := range templateParamPattern.FindAllStringSubmatch(text, -1) {
+            found[match[1] + match[2]] = true
+        }
+    }
+
+    err = sa.EachSource(func(fileSource FileSource) error {
+        if engine != EngineTemplate && !strings.HasSuffix(fileSource.SubPath(), templateSuffix) {
+            return nil
+        }
+        addParams(fileSource.SubPath())
+        if fileSource.IsDir() {
+            return nil
+        }
+
+        reader, err := fileSource.Reader()
+        if err != nil {
+            return err
+        }
+        defer reader.Close()
+
+        contents, err := ioutil.ReadAll(reader)
+        if err != nil {
+            return err
+        }
+        addParams(string(contents))
+        return nil
+    })
+
+    for name := range found {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+func Test_newEngineReplaceFunc_literal(t *testing.T) {
+    rf := newEngineReplaceFunc(map[string]string{"foo": "bar"}, EngineLiteral)
+    subPath, contents, err := rf("foo.txt", "foo {{ .Params.foo }}")
+    assertString(t, "Verify sub path is replaced literally", "bar.txt", subPath)
+    assertString(t, "Verify contents are replaced literally", "bar {{ .Params.bar }}", contents)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+}
+
+func Test_newEngineReplaceFunc_tmplSuffix(t *testing.T) {
+    rf := newEngineReplaceFunc(map[string]string{"name": "hoge"}, EngineLiteral)
+    subPath, contents, err := rf("{{ .Params.name }}/main.go.tmpl", "name {{ .Params.name | upper }}{{ if eq .Params.name \"x\" }}x{{ end }}")
+    assertString(t, "Verify sub path is rendered", "hoge/main.go", subPath)
+    assertString(t, "Verify contents are rendered", "name HOGE", contents)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+}
+
+func Test_newEngineReplaceFunc_template(t *testing.T) {
+    rf := newEngineReplaceFunc(map[string]string{"names": "a,b"}, EngineTemplate)
+    subPath, contents, err := rf("list.txt", "{{ range split \",\" .Params.names }}[{{ . }}]{{ end }}")
+    assertString(t, "Verify sub path is kept", "list.txt", subPath)
+    assertString(t, "Verify contents are rendered", "[a][b]", contents)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+}
+
+func Test_newEngineReplaceFunc_missingKey(t *testing.T) {
+    rf := newEngineReplaceFunc(map[string]string{}, EngineTemplate)
+    _, _, err := rf("a.txt", "{{ .Params.notFound }}")
+    if err == nil {
+        t.Error("Verify a missing parameter is an error")
+    }
+}
+
+func Test_checkEngine(t *testing.T) {
+    if checkEngine(EngineTemplate) != nil {
+        t.Error("Verify template is a known engine")
+    }
+    if checkEngine("mustache") == nil {
+        t.Error("Verify an unknown engine is an error")
+    }
+}
+
+func Test_findTemplateParams(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{
+        "main.go.tmpl": "package {{ .Params.name }}\n{{ index .Params \"app-name\" }}",
+        "README.md": "{{ .Params.notRendered }}"})
+    defer os.RemoveAll(srcDir)
+
+    names, err := findTemplateParams(newFileAccess(srcDir), EngineLiteral)
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+    assertString(t, "Verify parameters are found", "app-name,name", strings.Join(names, ","))
+
+    names, _ = findTemplateParams(newFileAccess(srcDir), EngineTemplate)
+    assertString(t, "Verify all files are searched", "app-name,name,notRendered", strings.Join(names, ","))
+}
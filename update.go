@@ -0,0 +1,285 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+)
+
+type UpdateParams struct {
+    Keywords []string
+    KeySeparator string
+    DestPath string
+    GithubAPIURL string
+    Ref string
+    TokenFile string
+}
+
+var errUpdateConflict = errors.New("Some files have conflicts")
+
+// conflictSuffix is added to a rendered file which cannot be merged into
+// a dest file, so that a change of the template is not lost.
+const conflictSuffix = ".template"
+
+// UpdateMain renders the template recorded in the dest path again and merges
+// changes of the template since the last generation into the dest path.
+func UpdateMain(up UpdateParams) error {
+    destPath := up.DestPath
+
+    m, err := readManifest(destPath)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error: no generation record is found in", destPath)
+        return err
+    }
+
+    flagParams, err := paramsToMap(up.Keywords, up.KeySeparator)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+    keyMap := mergeParams(m.Keywords, flagParams)
+
+    if up.Ref != "" {
+        m.Ref = up.Ref
+    }
+    sa := newSourceAccess(m.Source, &sourceConfig{sourceType: m.SourceType, githubAPIURL: up.GithubAPIURL, ref: m.Ref, tokenFile: up.TokenFile})
+    if closer, ok := sa.(io.Closer); ok {
+        defer closer.Close()
+    }
+    schema, err := loadSchema(sa)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+    keyMap, err = schema.apply(keyMap)
+    if err != nil {
+        return err
+    }
+
+    replaceKeys := keyMap
+    if m.CaseVariants {
+        replaceKeys = expandCaseVariants(keyMap)
+    }
+
+    filter, err := newSourceFilter(m.Includes, m.Excludes, append(m.Skips, schema.Skip...), append(m.Raws, schema.Raw...))
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+    filter.noBinaryDetect = m.NoBinaryDetect
+    _, isLocal := sa.(*fileAccess)
+    filter.localLinks = !isLocal
+
+    rendered := newMemoryDestAccess()
+    err = copyEachFileSource(sa, rendered, filter, newEngineReplaceFunc(replaceKeys, m.Engine), newEngineStreamReplaceFunc(replaceKeys, m.Engine))
+    if err != nil {
+        return err
+    }
+
+    // Changes in the dest path are rolled back when the update fails, so
+    // that the dest path is not left half merged.
+    j := newJournal(destPath)
+    conflict, err := mergeRendered(destPath, rendered, j)
+    if err == nil {
+        baseline := newBaselineDestAccess(newMemoryDestAccess(), destPath)
+        baseline.baseline.journal = j
+        err = copyMemoryDestAccess(rendered, baseline)
+        if err == nil {
+            m.Keywords = keyMap
+            m.setGenerated(sa, baseline)
+            err = writeJournaledManifest(destPath, m, j)
+        }
+    }
+    if err != nil {
+        if rollbackErr := j.rollback(); rollbackErr != nil {
+            fmt.Fprintln(os.Stderr, "Error: failed to roll back:", rollbackErr)
+        }
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return err
+    }
+
+    err = j.commit()
+    if err == nil && conflict {
+        fmt.Fprintln(os.Stderr, "Error: conflicts are found. Resolve conflict markers and " + conflictSuffix + " files and remove them.")
+        err = errUpdateConflict
+    }
+    return err
+}
+
+// mergeRendered applies the difference between the baseline and rendered
+// files to dest files. Changes are recorded in j.
+func mergeRendered(destPath string, rendered *memoryDestAccess, j *journal) (conflict bool, err error) {
+    basePath := filepath.Join(destPath, baselineDirName)
+    renderedFiles := map[string]bool{}
+
+    // Directories and symbolic links are created like generation.
+    da := newFileDestAccess(destPath, ConflictFail, nil)
+    da.journal = j
+
+    for _, subPath := range rendered.dirs {
+        err = da.MakeDir(subPath)
+        if err != nil {
+            return
+        }
+    }
+
+    for _, file := range rendered.files {
+        var action string
+        renderedFiles[file.subPath] = true
+        err = checkSymlinkParents(destPath, file.subPath, false)
+        if err != nil {
+            return
+        }
+        action, err = mergeFile(filepath.Join(basePath, file.subPath), filepath.Join(destPath, file.subPath), file.contents, filePerm(file.mode), j)
+        if err != nil {
+            return
+        }
+        if action == "Conflict" {
+            conflict = true
+        }
+        if action != "" {
+            printReport(action, filepath.Join(destPath, file.subPath))
+        }
+    }
+
+    // Symbolic links are only created when they don't exist locally.
+    for _, link := range rendered.links {
+        renderedFiles[link.subPath] = true
+        if _, lerr := os.Lstat(filepath.Join(destPath, link.subPath)); lerr == nil {
+            continue
+        }
+        err = da.Symlink(link.subPath, link.target)
+        if err != nil {
+            return
+        }
+    }
+
+    // Remove files which are removed from the template if they are not modified.
+    var removed []string
+    filepath.Walk(basePath, func(fullPath string, info os.FileInfo, err error) error {
+        if err != nil || info.IsDir() {
+            return nil
+        }
+        subPath := toSubPath(normalizePath(basePath, true), fullPath)
+        if !renderedFiles[subPath] {
+            removed = append(removed, subPath)
+        }
+        return nil
+    })
+    sort.Strings(removed)
+
+    for _, subPath := range removed {
+        base, _ := ioutil.ReadFile(filepath.Join(basePath, subPath))
+        ours, oursErr := ioutil.ReadFile(filepath.Join(destPath, subPath))
+        if oursErr != nil {
+            continue
+        }
+        if bytes.Equal(base, ours) {
+            err = j.moveAside(filepath.Join(destPath, subPath))
+            if err != nil {
+                return
+            }
+            printReport("Remove", filepath.Join(destPath, subPath))
+        } else {
+            printReport("Keep", filepath.Join(destPath, subPath))
+        }
+    }
+
+    return
+}
+
+// mergeFile merges a rendered file into a dest file and returns the action
+// to report. An empty action means the dest file is not changed.
+func mergeFile(basePath string, oursPath string, theirs []byte, perm os.FileMode, j *journal) (action string, err error) {
+    base, baseErr := ioutil.ReadFile(basePath)
+    hasBase := baseErr == nil
+    ours, oursErr := ioutil.ReadFile(oursPath)
+    hasOurs := oursErr == nil
+
+    switch {
+    case !hasOurs && !hasBase:
+        return "Create", writeFileMode(oursPath, theirs, perm, j)
+    case !hasOurs:
+        // The file is removed locally.
+        if bytes.Equal(base, theirs) {
+            return "", nil
+        }
+        return "Conflict", writeFileMode(oursPath + conflictSuffix, theirs, perm, j)
+    case bytes.Equal(ours, theirs):
+        return "", nil
+    case hasBase && bytes.Equal(base, theirs):
+        return "", nil
+    case hasBase && bytes.Equal(base, ours):
+        return "Update", writeFileMode(oursPath, theirs, perm, j)
+    }
+
+    if bytes.IndexByte(ours, 0) >= 0 || bytes.IndexByte(theirs, 0) >= 0 {
+        // Binary files cannot have conflict markers. Keep local one.
+        return "Conflict", writeFileMode(oursPath + conflictSuffix, theirs, perm, j)
+    }
+
+    merged, conflict := merge3(string(base), string(ours), string(theirs))
+    info, err := os.Stat(oursPath)
+    if err == nil {
+        // A merged file keeps the mode of the local file.
+        err = writeJournaledFile(oursPath, []byte(merged), info.Mode().Perm(), true, j)
+    }
+    if conflict {
+        return "Conflict", err
+    }
+    return "Merge", err
+}
+
+func copyMemoryDestAccess(src *memoryDestAccess, da DestAccess) error {
+    for _, subPath := range src.dirs {
+        err := da.MakeDir(subPath)
+        if err != nil {
+            return err
+        }
+    }
+    for _, file := range src.files {
+        err := da.WriteFile(file.subPath, bytes.NewReader(file.contents), file.mode, false)
+        if err != nil {
+            return err
+        }
+    }
+    for _, link := range src.links {
+        err := da.Symlink(link.subPath, link.target)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// writeFileMode writes a file and updates execute bits of the file even if
+// it already exists. A new file is masked by umask.
+func writeFileMode(path string, contents []byte, perm os.FileMode, j *journal) error {
+    info, err := os.Stat(path)
+    if err != nil {
+        return writeJournaledFile(path, contents, perm, false, j)
+    }
+    if info.IsDir() {
+        return errors.New("A directory exists at " + path)
+    }
+    return writeJournaledFile(path, contents, execPerm(info.Mode(), perm), true, j)
+}
+
+// writeJournaledFile keeps an original file in j to roll back and writes
+// a new file. perm is set exactly by chmod, otherwise it is masked by umask.
+func writeJournaledFile(path string, contents []byte, perm os.FileMode, chmod bool, j *journal) error {
+    if err := j.moveAside(path); err != nil {
+        return err
+    }
+    err := ioutil.WriteFile(path, contents, perm)
+    j.created(path)
+    if err == nil && chmod {
+        err = os.Chmod(path, perm)
+    }
+    return err
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func generateForUpdate(t *testing.T, files map[string]string) (srcDir string, destDir string) {
+    srcDir = newTemplateDir(t, files)
+    tmpDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    destDir = filepath.Join(tmpDir, "project")
+
+    err := StartMain(StartParams{
+        Keywords: []string{"foo=bar"},
+        KeySeparator: ",",
+        Arguments: []string{srcDir, destDir},
+        IncludeSuffixes: "*",
+        ExcludeSuffixes: ".png"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return
+}
+
+func readTestFile(path string) string {
+    contents, _ := ioutil.ReadFile(path)
+    return string(contents)
+}
+
+func Test_StartMain_recordsManifest(t *testing.T) {
+    srcDir, destDir := generateForUpdate(t, map[string]string{"foo.txt": "foo\n"})
+    defer os.RemoveAll(srcDir)
+    defer os.RemoveAll(filepath.Dir(destDir))
+
+    m, err := readManifest(destDir)
+    if err != nil {
+        t.Fatal("Verify manifest is written.", err)
+    }
+    assertString(t, "Verify source is recorded", srcDir, m.Source)
+    assertString(t, "Verify keywords are recorded", "bar", m.Keywords["foo"])
+    assertString(t, "Verify baseline is recorded", "bar\n", readTestFile(filepath.Join(destDir, baselineDirName, "bar.txt")))
+    assertString(t, "Verify version is recorded", Version, m.Version)
+    assertString(t, "Verify checksum is recorded", checksum([]byte("bar\n")), m.Files["bar.txt"])
+}
+
+func Test_StartMain_skippedManifest(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{"scripts/build.sh": "template\n", "a.txt": "a\n"})
+    defer os.RemoveAll(srcDir)
+    destDir := newTemplateDir(t, map[string]string{"scripts/build.sh": "local\n"})
+    defer os.RemoveAll(destDir)
+
+    err := StartMain(StartParams{KeySeparator: ",", Arguments: []string{srcDir, destDir}, IncludeSuffixes: "*", OnConflict: ConflictSkip})
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    m, err := readManifest(destDir)
+    if err != nil {
+        t.Fatal("Verify manifest is written.", err)
+    }
+    if _, ok := m.Files["scripts/build.sh"]; ok {
+        t.Error("Verify a skipped file is not recorded.", m.Files)
+    }
+    assertString(t, "Verify a generated file is recorded", checksum([]byte("a\n")), m.Files["a.txt"])
+    assertString(t, "Verify a skipped file is kept", "local\n", readTestFile(filepath.Join(destDir, "scripts/build.sh")))
+}
+
+func Test_StartMain_schemaEngine(t *testing.T) {
+    srcDir := newTemplateDir(t, map[string]string{"gokeleton.yaml": "engine: template\n", "a.txt": "{{ .Params.foo }}\n"})
+    defer os.RemoveAll(srcDir)
+    tmpDir, _ := ioutil.TempDir("", "gokeleton-dest")
+    defer os.RemoveAll(tmpDir)
+    destDir := filepath.Join(tmpDir, "project")
+
+    err := StartMain(StartParams{Keywords: []string{"foo=bar"}, KeySeparator: ",", Arguments: []string{srcDir, destDir}, IncludeSuffixes: "*"})
+    if err != nil {
+        t.Fatal("Verify no error found", err)
+    }
+    assertString(t, "Verify a file is rendered by an engine of a template", "bar\n", readTestFile(filepath.Join(destDir, "a.txt")))
+    m, _ := readManifest(destDir)
+    assertString(t, "Verify an engine of a template is recorded", EngineTemplate, m.Engine)
+}
+
+func Test_UpdateMain(t *testing.T) {
+    srcDir, destDir := generateForUpdate(t, map[string]string{
+        "foo.txt": "line1\nfoo\nline3\n",
+        "keep.txt": "keep\n",
+        "removed.txt": "removed\n"})
+    defer os.RemoveAll(srcDir)
+    defer os.RemoveAll(filepath.Dir(destDir))
+
+    // local change
+    ioutil.WriteFile(filepath.Join(destDir, "bar.txt"), []byte("local\nbar\nline3\n"), 0666)
+    // template changes
+    ioutil.WriteFile(filepath.Join(srcDir, "foo.txt"), []byte("line1\nfoo\ntemplate\n"), 0666)
+    ioutil.WriteFile(filepath.Join(srcDir, "added.txt"), []byte("foo\n"), 0666)
+    os.Remove(filepath.Join(srcDir, "removed.txt"))
+
+    err := UpdateMain(UpdateParams{KeySeparator: ",", DestPath: destDir})
+    if err != nil {
+        t.Error("Verify no error found", err)
+    }
+
+    assertString(t, "Verify changes are merged", "local\nbar\ntemplate\n", readTestFile(filepath.Join(destDir, "bar.txt")))
+    assertString(t, "Verify an added file is created", "bar\n", readTestFile(filepath.Join(destDir, "added.txt")))
+    assertString(t, "Verify a file is kept", "keep\n", readTestFile(filepath.Join(destDir, "keep.txt")))
+    if isExistingFile(filepath.Join(destDir, "removed.txt")) {
+        t.Error("Verify a removed file is removed")
+    }
+    assertString(t, "Verify baseline is updated", "line1\nbar\ntemplate\n", readTestFile(filepath.Join(destDir, baselineDirName, "bar.txt")))
+    if files, _ := filepath.Glob(filepath.Join(destDir, ".gokeleton-journal-*")); len(files) != 0 {
+        t.Error("Verify a journal is removed.", files)
+    }
+}
+
+func Test_UpdateMain_conflict(t *testing.T) {
+    srcDir, destDir := generateForUpdate(t, map[string]string{"foo.txt": "a\nfoo\nc\n"})
+    defer os.RemoveAll(srcDir)
+    defer os.RemoveAll(filepath.Dir(destDir))
+
+    ioutil.WriteFile(filepath.Join(destDir, "bar.txt"), []byte("a\nlocal\nc\n"), 0666)
+    ioutil.WriteFile(filepath.Join(srcDir, "foo.txt"), []byte("a\ntemplate\nc\n"), 0666)
+
+    err := UpdateMain(UpdateParams{KeySeparator: ",", DestPath: destDir})
+    if err != errUpdateConflict {
+        t.Error("Verify conflict is returned", err)
+    }
+    if !strings.Contains(readTestFile(filepath.Join(destDir, "bar.txt")), conflictStartMarker + "local\n") {
+        t.Error("Verify conflict markers are written")
+    }
+}
+
+func Test_UpdateMain_conflictTemplate(t *testing.T) {
+    srcDir, destDir := generateForUpdate(t, map[string]string{"foo.txt": "foo\n", "foo.bin": "a\x00foo"})
+    defer os.RemoveAll(srcDir)
+    defer os.RemoveAll(filepath.Dir(destDir))
+
+    os.Remove(filepath.Join(destDir, "bar.txt"))
+    ioutil.WriteFile(filepath.Join(destDir, "bar.bin"), []byte("local\x00"), 0666)
+    ioutil.WriteFile(filepath.Join(srcDir, "foo.txt"), []byte("foo\ntemplate\n"), 0666)
+    ioutil.WriteFile(filepath.Join(srcDir, "foo.bin"), []byte("template\x00foo"), 0666)
+
+    err := UpdateMain(UpdateParams{KeySeparator: ",", DestPath: destDir})
+    if err != errUpdateConflict {
+        t.Error("Verify conflict is returned", err)
+    }
+    assertString(t, "Verify a removed file is not created", "", readTestFile(filepath.Join(destDir, "bar.txt")))
+    assertString(t, "Verify a change of a removed file is kept", "bar\ntemplate\n", readTestFile(filepath.Join(destDir, "bar.txt" + conflictSuffix)))
+    assertString(t, "Verify a local binary file is kept", "local\x00", readTestFile(filepath.Join(destDir, "bar.bin")))
+    assertString(t, "Verify a change of a binary file is kept", "template\x00foo", readTestFile(filepath.Join(destDir, "bar.bin" + conflictSuffix)))
+}
+
+func Test_UpdateMain_rollback(t *testing.T) {
+    srcDir, destDir := generateForUpdate(t, map[string]string{"a.txt": "a\n", "removed.txt": "removed\n"})
+    defer os.RemoveAll(srcDir)
+    defer os.RemoveAll(filepath.Dir(destDir))
+    manifestContents := readTestFile(filepath.Join(destDir, manifestFileName))
+
+    ioutil.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a\ntemplate\n"), 0666)
+    os.Remove(filepath.Join(srcDir, "removed.txt"))
+    // A new file of the template cannot be written over a local directory.
+    ioutil.WriteFile(filepath.Join(srcDir, "z.txt"), []byte("z\n"), 0666)
+    os.Mkdir(filepath.Join(destDir, "z.txt"), 0777)
+
+    if err := UpdateMain(UpdateParams{KeySeparator: ",", DestPath: destDir}); err == nil || err == errUpdateConflict {
+        t.Fatal("Verify an update fails.", err)
+    }
+    assertString(t, "Verify a merged file is rolled back", "a\n", readTestFile(filepath.Join(destDir, "a.txt")))
+    assertString(t, "Verify a removed file is rolled back", "removed\n", readTestFile(filepath.Join(destDir, "removed.txt")))
+    assertString(t, "Verify a baseline is kept", "a\n", readTestFile(filepath.Join(destDir, baselineDirName, "a.txt")))
+    assertString(t, "Verify a manifest is kept", manifestContents, readTestFile(filepath.Join(destDir, manifestFileName)))
+    if isDir, _ := isDirectory(filepath.Join(destDir, "z.txt")); !isDir {
+        t.Error("Verify a local directory is kept.")
+    }
+    files, _ := filepath.Glob(filepath.Join(destDir, ".gokeleton-journal-*"))
+    if len(files) != 0 {
+        t.Error("Verify a journal is removed.", files)
+    }
+}
+
+func Test_UpdateMain_noManifest(t *testing.T) {
+    err := UpdateMain(UpdateParams{KeySeparator: ",", DestPath: "/tmp_not_found"})
+    if err == nil {
+        t.Error("Verify error is returned without a manifest")
+    }
+}
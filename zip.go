@@ -0,0 +1,116 @@
+package main
+
+import (
+    "archive/zip"
+    "crypto/sha256"
+    "io"
+    "io/ioutil"
+    "os"
+    "strings"
+)
+
+// zipFileSource is an entry of a zip archive.
+type zipFileSource struct {
+    file *zip.File
+    path string
+}
+
+func newZipFileSource(zipFile *zip.File, path string) (zf *zipFileSource) {
+    zf = new(zipFileSource)
+    zf.file = zipFile
+    zf.path = path
+    return
+}
+
+// FileSource
+func (zf *zipFileSource) SubPath() string {
+    return zf.path
+}
+
+func (zf *zipFileSource) IsDir() bool {
+    return zf.file.FileInfo().IsDir()
+}
+
+func (zf *zipFileSource) Reader() (io.ReadCloser, error) {
+    return zf.file.Open()
+}
+
+func (zf *zipFileSource) Mode() os.FileMode {
+    return zf.file.Mode()
+}
+
+// LinkTarget returns contents of an entry because a zip has a link target
+// as contents of a symbolic link.
+func (zf *zipFileSource) LinkTarget() (string, error) {
+    reader, err := zf.file.Open()
+    if err != nil {
+        return "", err
+    }
+    defer reader.Close()
+
+    target, err := ioutil.ReadAll(reader)
+    return string(target), err
+}
+
+// archiveEntry
+func (zf *zipFileSource) entryName() string {
+    return zf.file.Name
+}
+
+func (zf *zipFileSource) entryIsDir() bool {
+    return zf.IsDir()
+}
+
+func (zf *zipFileSource) source(path string) FileSource {
+    return newZipFileSource(zf.file, path)
+}
+
+// eachZipSource calls callback for entries under basePath of a zip archive
+// whose files are in a top directory like <repo>-<commit>/.
+func eachZipSource(zipReader *zip.Reader, basePath string, callback FileSourceFunc) error {
+    entries := make([]archiveEntry, len(zipReader.File))
+    for i, f := range zipReader.File {
+        entries[i] = newZipFileSource(f, f.Name)
+    }
+    return eachArchiveSource(entries, basePath, callback)
+}
+
+// spoolZip writes a zip archive to a temporary file instead of memory
+// and opens it. A caller removes the file.
+func spoolZip(reader io.Reader) (zipReader *zip.Reader, zipFile *os.File, archiveHash string, err error) {
+    zipFile, err = ioutil.TempFile("", "gokeleton-zip")
+    if err != nil {
+        return nil, nil, "", err
+    }
+
+    hash := sha256.New()
+    size, err := io.Copy(io.MultiWriter(zipFile, hash), reader)
+    if err == nil {
+        zipReader, err = zip.NewReader(zipFile, size)
+    }
+    if err != nil {
+        return nil, zipFile, "", err
+    }
+    return zipReader, zipFile, checksumString(hash.Sum(nil)), nil
+}
+
+// zipRevision returns a commit of a zip archive. GitHub sets the commit to
+// the comment of a zipball, and hosting services set it to the suffix of
+// the top directory.
+func zipRevision(zipReader *zip.Reader) string {
+    if comment := strings.TrimSpace(zipReader.Comment); comment != "" {
+        return comment
+    }
+    if len(zipReader.File) == 0 {
+        return ""
+    }
+
+    name := zipReader.File[0].Name
+    if index := strings.Index(name, "/"); index != -1 {
+        name = name[:index]
+    }
+    if index := strings.LastIndex(name, "-"); index != -1 {
+        return name[index + 1:]
+    }
+    return ""
+}